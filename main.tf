@@ -1,19 +1,33 @@
 resource "helm_release" "delegate" {
   name             = var.delegate_name
-  repository       = var.helm_repository
-  chart            = "harness-delegate-ng"
+  repository       = var.helm_repository != "" ? var.helm_repository : null
+  chart            = var.chart
+  version          = var.chart_version != "" ? var.chart_version : null
   namespace        = var.namespace
   create_namespace = var.create_namespace
 
   values = [data.utils_deep_merge_yaml.values.output]
 
   # ref https://github.com/hashicorp/terraform-provider-helm/pull/480
-  set_sensitive {
-    name  = "delegateToken"
-    value = var.delegate_token
-    type = "string"
-  }
+  # Skipped when the token comes from an existing Secret, so no token material reaches the state
+  set_sensitive = local.token_from_secret ? [] : [
+    {
+      name  = "delegateToken"
+      value = var.delegate_token
+      type  = "string"
+    },
+  ]
 
+  lifecycle {
+    precondition {
+      condition     = nonsensitive(var.delegate_token != "") != local.token_from_secret
+      error_message = "Set exactly one of delegate_token and existing_delegate_token_secret_name."
+    }
+    precondition {
+      condition     = var.ca_bundle_secret_name == "" || var.ca_bundle_configmap_name == ""
+      error_message = "Only one of ca_bundle_secret_name and ca_bundle_configmap_name can be set."
+    }
+  }
 }
 
 locals {
@@ -24,7 +38,39 @@ locals {
     delegateName         = var.delegate_name,
     delegateDockerImage  = var.delegate_image,
     replicas             = var.replicas,
-    upgrader             = { enabled = var.upgrader_enabled }
+    # Restart the pods when the token changes. Only the hash is exposed, never the token.
+    podAnnotations = {
+      for key, checksum in { "checksum/delegate-token" = nonsensitive(sha256(var.delegate_token)) } : key => checksum if !local.token_from_secret
+    }
+    existingDelegateToken = var.existing_delegate_token_secret_name
+    autoscaling = merge(
+      { enabled = var.autoscaling != null },
+      {
+        for key, value in {
+          minReplicas                       = try(var.autoscaling.min_replicas, null)
+          maxReplicas                       = try(var.autoscaling.max_replicas, null)
+          targetCPUUtilizationPercentage    = try(var.autoscaling.target_cpu_utilization, null)
+          targetMemoryUtilizationPercentage = try(var.autoscaling.target_memory_utilization, null)
+        } : key => value if value != null
+      },
+    )
+    podDisruptionBudget = merge(
+      { enabled = var.pod_disruption_budget != null },
+      {
+        for key, value in {
+          minAvailable   = try(var.pod_disruption_budget.min_available, null)
+          maxUnavailable = try(var.pod_disruption_budget.max_unavailable, null)
+        } : key => value if value != null
+      },
+    )
+    upgrader = merge(
+      {
+        enabled          = var.upgrader_enabled
+        imagePullSecrets = [for name in var.image_pull_secrets : { name = name }]
+      },
+      # Only override the chart's upgrader image when one is set
+      { for key, image in { upgraderDockerImage = var.upgrader_image } : key => image if image != "" },
+    )
     nextGen              = var.next_gen,
     proxyUser            = var.proxy_user,
     proxyPassword        = var.proxy_password,
@@ -35,13 +81,87 @@ locals {
     initScript           = var.init_script,
     deployMode           = var.deploy_mode
     mTLS                 = { secretName = var.mtls_secret_name } 
+    imagePullSecrets     = [for name in var.image_pull_secrets : { name = name }]
+    custom_volumes       = local.custom_volumes
+    custom_mounts        = local.custom_mounts
+    custom_envs          = local.custom_envs
+    commonLabels         = var.common_labels
+    commonAnnotations    = var.common_annotations
+    nodeSelector         = var.node_selector
+    tolerations          = local.tolerations
+    affinity             = var.affinity
+    topologySpreadConstraints = local.topology_spread_constraints
   })
+
+  custom_volumes = local.ca_bundle_enabled ? [local.ca_bundle_volume] : []
+  custom_mounts  = local.ca_bundle_enabled ? [local.ca_bundle_mount] : []
+  custom_envs = flatten([
+    local.ca_bundle_enabled ? [local.ca_bundle_env] : [],
+    local.token_from_secret ? [local.token_env] : [],
+  ])
+
+  # The deep merge replaces lists, so an overlay in var.values setting one of these would drop the
+  # token env or the CA bundle. The overlay's entries are appended to the module's instead.
+  values_overlay = try(yamldecode(var.values), null)
+  custom_lists = {
+    for key, entries in {
+      custom_volumes = local.custom_volumes
+      custom_mounts  = local.custom_mounts
+      custom_envs    = local.custom_envs
+    } : key => try(concat(entries, local.values_overlay[key]), entries) if length(entries) > 0
+  }
+
+  # Token from an existing Secret: the explicit env honours a key other than DELEGATE_TOKEN
+  token_from_secret = var.existing_delegate_token_secret_name != ""
+  token_env = {
+    name = "DELEGATE_TOKEN"
+    valueFrom = {
+      secretKeyRef = { name = var.existing_delegate_token_secret_name, key = var.existing_delegate_token_secret_key }
+    }
+  }
+
+  # Unset optional attributes are dropped rather than rendered as nulls
+  tolerations = [
+    for toleration in var.tolerations : {
+      for key, value in {
+        key               = toleration.key
+        operator          = toleration.operator
+        value             = toleration.value
+        effect            = toleration.effect
+        tolerationSeconds = toleration.toleration_seconds
+      } : key => value if value != null
+    }
+  ]
+  topology_spread_constraints = [
+    for constraint in var.topology_spread_constraints : {
+      topologyKey       = constraint.topology_key
+      maxSkew           = constraint.max_skew
+      whenUnsatisfiable = constraint.when_unsatisfiable
+      labelSelector = {
+        matchLabels = constraint.match_labels != null ? constraint.match_labels : { "app.kubernetes.io/instance" = var.delegate_name }
+      }
+    }
+  ]
+
+  # Custom CA bundle: the delegate adds the certificates found in the mount path to its
+  # Java trust store and to every file listed in DESTINATION_CA_PATH at startup
+  ca_bundle_enabled    = var.ca_bundle_secret_name != "" || var.ca_bundle_configmap_name != ""
+  ca_bundle_mount_path = "/opt/harness-delegate/ca-bundle"
+  ca_bundle_items      = [{ key = var.ca_bundle_key, path = "ca.bundle" }]
+  ca_bundle_volume = {
+    name      = "ca-bundle"
+    secret    = var.ca_bundle_secret_name != "" ? { secretName = var.ca_bundle_secret_name, items = local.ca_bundle_items } : null
+    configMap = var.ca_bundle_configmap_name != "" ? { name = var.ca_bundle_configmap_name, items = local.ca_bundle_items } : null
+  }
+  ca_bundle_mount = { name = "ca-bundle", mountPath = local.ca_bundle_mount_path, readOnly = true }
+  ca_bundle_env   = { name = "DESTINATION_CA_PATH", value = "/etc/ssl/certs/ca-bundle.crt,/etc/pki/tls/certs/ca-bundle.crt" }
 }
 
 data "utils_deep_merge_yaml" "values" {
   input = compact([
     local.values,
-    var.values
+    var.values,
+    length(local.custom_lists) > 0 ? yamlencode(local.custom_lists) : "",
   ])
 }
 
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/docker"
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/stretchr/testify/require"
+)
+
+// plainHTTPRegistries holds the host:port of the registries started by StartLocalRegistry, which
+// serve plain HTTP. Helm 3.13 and later use HTTPS unless told otherwise with --plain-http.
+var plainHTTPRegistries sync.Map
+
+// PlainHTTPRegistry reports whether the registry of an oci:// repository serves plain HTTP
+func PlainHTTPRegistry(repository string) bool {
+	host := strings.SplitN(strings.TrimPrefix(repository, "oci://"), "/", 2)[0]
+	_, ok := plainHTTPRegistries.Load(host)
+	return ok
+}
+
+// StartLocalRegistry runs a registry:2 container as a stand-in for an internal mirror and
+// returns its host:port. The container is removed when the test finishes. The registry serves
+// plain HTTP, see PlainHTTPRegistry.
+func StartLocalRegistry(t *testing.T) string {
+	name := fmt.Sprintf("harness-delegate-mirror-%s", strings.ToLower(random.UniqueId()))
+
+	docker.Run(t, "registry:2", &docker.RunOptions{
+		Detach:       true,
+		Remove:       true,
+		Name:         name,
+		OtherOptions: []string{"-p", "127.0.0.1::5000"},
+	})
+	t.Cleanup(func() {
+		docker.Stop(t, []string{name}, &docker.StopOptions{})
+	})
+
+	// `docker port` prints 127.0.0.1:<port>
+	address, err := shell.RunCommandAndGetStdOutE(t, shell.Command{
+		Command: "docker",
+		Args:    []string{"port", name, "5000/tcp"},
+	})
+	require.NoError(t, err)
+
+	host := strings.TrimSpace(strings.Split(address, "\n")[0])
+	host = strings.Replace(host, "127.0.0.1", "localhost", 1)
+	plainHTTPRegistries.Store(host, true)
+	t.Cleanup(func() {
+		plainHTTPRegistries.Delete(host)
+	})
+	return host
+}
+
+// MirrorChart pushes the delegate chart to the registry under oci://<registry>/charts and returns
+// the path of the chart archive. MIRROR_CHART_ARCHIVE points at a pre-downloaded archive;
+// otherwise the chart is pulled from repository.
+func MirrorChart(t *testing.T, registry, repository string) string {
+	helmOptions := &helm.Options{}
+
+	archive := os.Getenv("MIRROR_CHART_ARCHIVE")
+	if archive == "" {
+		RefuseNetwork(t, fmt.Sprintf("chart %s from %s (set MIRROR_CHART_ARCHIVE)", defaultChart, repository))
+		destination := t.TempDir()
+		_, err := helm.RunHelmCommandAndGetOutputE(t, helmOptions, "pull", defaultChart, "--repo", repository, "--destination", destination)
+		require.NoError(t, err)
+
+		matches, err := filepath.Glob(filepath.Join(destination, defaultChart+"-*.tgz"))
+		require.NoError(t, err)
+		require.Len(t, matches, 1, "helm pull should download a single chart archive")
+		archive = matches[0]
+	}
+
+	args := []string{"push", archive, fmt.Sprintf("oci://%s/charts", registry)}
+	if PlainHTTPRegistry(registry) {
+		args = append(args, "--plain-http")
+	}
+	_, err := helm.RunHelmCommandAndGetOutputE(t, helmOptions, args[0], args[1:]...)
+	require.NoError(t, err)
+
+	return archive
+}
+
+// MirrorImage copies an image from the local Docker image cache (pulling it first if missing)
+// into the registry, keeping its repository path, and returns the mirrored reference. A reference
+// pinned by digest stays pinned, to the digest of the pushed image; without a tag it is pushed
+// under a tag derived from the digest rather than latest.
+func MirrorImage(t *testing.T, registry, source string) string {
+	image, err := ParseImageReference(source)
+	require.NoError(t, err)
+
+	repository := fmt.Sprintf("%s/%s", registry, strings.TrimPrefix(image.Repository, "library/"))
+	tag := image.Tag
+	if tag == "" && image.Digest != "" {
+		tag = strings.Replace(image.Digest, ":", "-", 1)
+	}
+	target := repository
+	if tag != "" {
+		target += ":" + tag
+	}
+
+	if _, err := shell.RunCommandAndGetOutputE(t, shell.Command{Command: "docker", Args: []string{"image", "inspect", source}}); err != nil {
+		RefuseNetwork(t, "image "+source)
+		shell.RunCommand(t, shell.Command{Command: "docker", Args: []string{"pull", source}})
+	}
+	shell.RunCommand(t, shell.Command{Command: "docker", Args: []string{"tag", source, target}})
+	docker.Push(t, nil, target)
+
+	if image.Digest == "" {
+		return target
+	}
+
+	// The pushed manifest may differ from the source one, e.g. a platform image of a multi-arch
+	// index, so pin the digest the registry reports for it
+	repoDigests, err := shell.RunCommandAndGetStdOutE(t, shell.Command{
+		Command: "docker",
+		Args:    []string{"image", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", target},
+	})
+	require.NoError(t, err)
+	for _, repoDigest := range strings.Fields(repoDigests) {
+		if digest, ok := strings.CutPrefix(repoDigest, repository+"@"); ok {
+			mirrored := repository
+			if image.Tag != "" {
+				mirrored += ":" + image.Tag
+			}
+			return mirrored + "@" + digest
+		}
+	}
+	require.FailNow(t, "Missing digest", "No digest of %s found after pushing it", target)
+	return ""
+}
+
+// ValidateImagePullSecrets validates that every workload references the given image pull secrets
+func ValidateImagePullSecrets(t *testing.T, workloads []WorkloadPodSpec, secretNames []string) {
+	for _, workload := range workloads {
+		var names []string
+		for _, reference := range workload.Template.Spec.ImagePullSecrets {
+			names = append(names, reference.Name)
+		}
+		for _, secretName := range secretNames {
+			require.Contains(t, names, secretName, "%s should reference image pull secret %s", workload, secretName)
+		}
+	}
+}
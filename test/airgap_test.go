@@ -0,0 +1,75 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAirGappedDelegateFromMirror(t *testing.T) {
+	// Load environment variables from .env file
+	_ = godotenv.Load(".env")
+
+	delegate_image := os.Getenv("DELEGATE_IMAGE")
+	if delegate_image == "" {
+		delegate_image = "harness/delegate:24.07.83404"
+	}
+	upgrader_image := os.Getenv("UPGRADER_IMAGE")
+	if upgrader_image == "" {
+		upgrader_image = "harness/upgrader:latest"
+	}
+	pullSecrets := []string{"mirror-pull-secret"}
+
+	// Populate the mirror stand-in with the chart and images
+	registry := StartLocalRegistry(t)
+	chartArchive := MirrorChart(t, registry, defaultHelmRepository)
+	mirroredDelegateImage := MirrorImage(t, registry, delegate_image)
+	mirroredUpgraderImage := MirrorImage(t, registry, upgrader_image)
+
+	// A local chart path is the other offline chart source
+	chartDir := t.TempDir()
+	shell.RunCommand(t, shell.Command{Command: "tar", Args: []string{"-xzf", chartArchive, "-C", chartDir}})
+
+	testCases := []struct {
+		name       string
+		repository string
+		chart      string
+	}{
+		{name: "oci registry", repository: fmt.Sprintf("oci://%s/charts", registry), chart: defaultChart},
+		{name: "local chart path", repository: "", chart: fmt.Sprintf("%s/%s", chartDir, defaultChart)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+			vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+			vars["helm_repository"] = tc.repository
+			vars["chart"] = tc.chart
+			vars["delegate_image"] = mirroredDelegateImage
+			vars["upgrader_image"] = mirroredUpgraderImage
+			vars["upgrader_enabled"] = true
+			vars["image_pull_secrets"] = pullSecrets
+
+			workloads := RenderedWorkloads(t, &terraform.Options{
+				TerraformDir: CopyModuleDir(t),
+				Vars:         vars,
+			})
+
+			// Every image must come from the mirror and pull with the configured secrets
+			ValidateImagePolicy(t, workloads, ImagePolicy{AllowedRegistries: []string{registry}})
+			ValidateImagePullSecrets(t, workloads, pullSecrets)
+
+			delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+			require.Equal(t, mirroredDelegateImage, delegate.Template.Spec.Containers[0].Image)
+			upgrader := FindWorkload(t, workloads, "CronJob", fmt.Sprintf("%s-upgrader-job", delegateName))
+			require.Equal(t, mirroredUpgraderImage, upgrader.Template.Spec.Containers[0].Image)
+		})
+	}
+}
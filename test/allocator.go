@@ -0,0 +1,113 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Labels put on everything a test creates, so that the sweeper can find what a crashed run left behind
+const (
+	TestManagedByLabel = "harness-delegate-test/managed-by"
+	TestManagedByValue = "terratest"
+	// TestCreatedAtLabel holds the creation time as Unix seconds, as label values can't hold a timestamp
+	TestCreatedAtLabel = "harness-delegate-test/created-at"
+	TestNameLabel      = "harness-delegate-test/test"
+)
+
+var invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// labelValue turns s into a valid label value: at most 63 characters, alphanumeric at both ends
+func labelValue(s string) string {
+	s = invalidLabelValueChars.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-_.")
+}
+
+// TestResourceLabels returns the labels identifying resources created by the test at createdAt
+func TestResourceLabels(t *testing.T, createdAt time.Time) map[string]string {
+	return map[string]string{
+		TestManagedByLabel: TestManagedByValue,
+		TestCreatedAtLabel: strconv.FormatInt(createdAt.Unix(), 10),
+		TestNameLabel:      labelValue(t.Name()),
+	}
+}
+
+// TestNamespace is a namespace allocated to a single test
+type TestNamespace struct {
+	Name string
+	// Labels are the TestResourceLabels of the namespace, to pass on as common_labels
+	Labels         map[string]string
+	KubectlOptions *k8s.KubectlOptions
+}
+
+// AllocateNamespace creates a uniquely named, labelled namespace for the test and deletes it when
+// the test and its subtests complete
+func AllocateNamespace(t *testing.T, prefix string) *TestNamespace {
+	return AllocateNamespaceWithLabels(t, prefix, nil)
+}
+
+// AllocateNamespaceWithLabels is AllocateNamespace with extra namespace labels, e.g. Pod Security
+// Admission levels
+func AllocateNamespaceWithLabels(t *testing.T, prefix string, extraLabels map[string]string) *TestNamespace {
+	return AllocateNamespaceOn(t, DefaultClusterTarget(), prefix, extraLabels)
+}
+
+// AllocateNamespaceOn is AllocateNamespaceWithLabels on the given cluster target
+func AllocateNamespaceOn(t *testing.T, target ClusterTarget, prefix string, extraLabels map[string]string) *TestNamespace {
+	name := fmt.Sprintf("%s-%s", prefix, strings.ToLower(random.UniqueId()))
+	require.LessOrEqual(t, len(name), 63, "Namespace name %s is too long", name)
+
+	testLabels := TestResourceLabels(t, time.Now())
+	labels := make(map[string]string, len(testLabels)+len(extraLabels))
+	for key, value := range extraLabels {
+		labels[key] = value
+	}
+	for key, value := range testLabels {
+		labels[key] = value
+	}
+
+	kubectlOptions := target.KubectlOptions(name)
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+	_, err = client.CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err, "Creating namespace %s", name)
+
+	// Cleanups run after deferred calls and in reverse order, so the test's terraform destroy,
+	// deferred or registered by LiveTerraformOptions, has already run
+	t.Cleanup(func() {
+		if err := k8s.DeleteNamespaceE(t, kubectlOptions, name); err != nil {
+			t.Errorf("Deleting namespace %s: %v", name, err)
+		}
+	})
+
+	return &TestNamespace{Name: name, Labels: testLabels, KubectlOptions: kubectlOptions}
+}
+
+// CopyModuleDir copies the module to a temporary directory owned by the test, so that tests
+// running in parallel don't share a .terraform directory or a state file
+func CopyModuleDir(t *testing.T) string {
+	dir, err := files.CopyTerraformFolderToTemp(ModuleDir, labelValue(t.Name()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return filepath.Clean(dir)
+}
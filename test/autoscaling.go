@@ -0,0 +1,121 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AutoscalingExpectation is the HorizontalPodAutoscaler the module's `autoscaling` input should produce
+type AutoscalingExpectation struct {
+	Deployment   string
+	MinReplicas  int32
+	MaxReplicas  int32
+	TargetCPU    int32
+	TargetMemory int32
+}
+
+// CheckHorizontalPodAutoscaler compares an HPA with the expectation and returns one message
+// per difference
+func CheckHorizontalPodAutoscaler(hpa autoscalingv2.HorizontalPodAutoscaler, expected AutoscalingExpectation) []string {
+	var issues []string
+
+	target := hpa.Spec.ScaleTargetRef
+	if target.Kind != "Deployment" || target.Name != expected.Deployment {
+		issues = append(issues, fmt.Sprintf("scaleTargetRef should be Deployment/%s, got %s/%s", expected.Deployment, target.Kind, target.Name))
+	}
+	if target.APIVersion != "apps/v1" {
+		issues = append(issues, fmt.Sprintf("scaleTargetRef apiVersion should be apps/v1, got %q", target.APIVersion))
+	}
+
+	if hpa.Spec.MinReplicas == nil || *hpa.Spec.MinReplicas != expected.MinReplicas {
+		issues = append(issues, fmt.Sprintf("minReplicas should be %d", expected.MinReplicas))
+	}
+	if hpa.Spec.MaxReplicas != expected.MaxReplicas {
+		issues = append(issues, fmt.Sprintf("maxReplicas should be %d, got %d", expected.MaxReplicas, hpa.Spec.MaxReplicas))
+	}
+
+	targets := map[corev1.ResourceName]int32{}
+	if expected.TargetCPU != 0 {
+		targets[corev1.ResourceCPU] = expected.TargetCPU
+	}
+	if expected.TargetMemory != 0 {
+		targets[corev1.ResourceMemory] = expected.TargetMemory
+	}
+	for resource, utilization := range targets {
+		var found bool
+		for _, metric := range hpa.Spec.Metrics {
+			if metric.Type != autoscalingv2.ResourceMetricSourceType || metric.Resource == nil || metric.Resource.Name != resource {
+				continue
+			}
+			found = metric.Resource.Target.Type == autoscalingv2.UtilizationMetricType &&
+				metric.Resource.Target.AverageUtilization != nil &&
+				*metric.Resource.Target.AverageUtilization == utilization
+		}
+		if !found {
+			issues = append(issues, fmt.Sprintf("should target %d%% average %s utilization", utilization, resource))
+		}
+	}
+
+	sort.Strings(issues)
+	return issues
+}
+
+// FindHorizontalPodAutoscaler decodes the single HPA of a manifest. autoscaling/v2beta2 has the
+// same shape as autoscaling/v2 and is accepted.
+func FindHorizontalPodAutoscaler(t *testing.T, objects []ManifestObject) autoscalingv2.HorizontalPodAutoscaler {
+	var found []autoscalingv2.HorizontalPodAutoscaler
+	for _, object := range objects {
+		if object.Kind != "HorizontalPodAutoscaler" {
+			continue
+		}
+		require.Contains(t, []string{"autoscaling/v2", "autoscaling/v2beta2"}, object.APIVersion,
+			"%s uses an unsupported API version", object)
+
+		var hpa autoscalingv2.HorizontalPodAutoscaler
+		require.NoError(t, object.Decode(&hpa))
+		found = append(found, hpa)
+	}
+	require.Len(t, found, 1, "The manifest should contain a single HorizontalPodAutoscaler")
+	return found[0]
+}
+
+// ValidateReplicasOwnedByHPA validates that the rendered Deployment leaves spec.replicas unset, so
+// that re-applying the release does not reset the replica count chosen by the HPA
+func ValidateReplicasOwnedByHPA(t *testing.T, objects []ManifestObject, deploymentName string) {
+	for _, object := range objects {
+		if object.Kind != "Deployment" || object.Metadata.Name != deploymentName {
+			continue
+		}
+		var deployment appsv1.Deployment
+		require.NoError(t, object.Decode(&deployment))
+		require.Nil(t, deployment.Spec.Replicas, "Deployment %s should not set replicas when autoscaling is enabled", deploymentName)
+		return
+	}
+	require.Failf(t, "Deployment not found", "Deployment/%s is not in the manifest", deploymentName)
+}
+
+// GetHorizontalPodAutoscaler returns a live HPA
+func GetHorizontalPodAutoscaler(t *testing.T, kubectlOptions *k8s.KubectlOptions, name string) *autoscalingv2.HorizontalPodAutoscaler {
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+
+	hpa, err := client.AutoscalingV2().HorizontalPodAutoscalers(kubectlOptions.Namespace).Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	return hpa
+}
+
+// ValidateNoDrift validates that `terraform plan` shows no changes for the applied configuration
+func ValidateNoDrift(t *testing.T, terraformOptions *terraform.Options) {
+	exitCode := terraform.PlanExitCode(t, terraformOptions)
+	require.Equal(t, 0, exitCode, "terraform plan should show no changes after apply")
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCheckHorizontalPodAutoscaler(t *testing.T) {
+	minReplicas := int32(2)
+	utilization := int32(70)
+	hpa := autoscalingv2.HorizontalPodAutoscaler{
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "delegate"},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    5,
+			Metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name:   corev1.ResourceCPU,
+					Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &utilization},
+				},
+			}},
+		},
+	}
+
+	assert.Empty(t, CheckHorizontalPodAutoscaler(hpa, AutoscalingExpectation{Deployment: "delegate", MinReplicas: 2, MaxReplicas: 5, TargetCPU: 70}))
+	assert.Len(t, CheckHorizontalPodAutoscaler(hpa, AutoscalingExpectation{Deployment: "other", MinReplicas: 1, MaxReplicas: 5, TargetCPU: 80, TargetMemory: 80}), 4)
+}
+
+func TestRenderedDelegateAutoscaling(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+	vars["autoscaling"] = map[string]interface{}{
+		"min_replicas":              2,
+		"max_replicas":              5,
+		"target_cpu_utilization":    70,
+		"target_memory_utilization": 85,
+	}
+
+	objects, err := ParseManifest(RenderDelegateManifest(t, &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	}))
+	require.NoError(t, err)
+
+	hpa := FindHorizontalPodAutoscaler(t, objects)
+	assert.Empty(t, CheckHorizontalPodAutoscaler(hpa, AutoscalingExpectation{
+		Deployment:   delegateName,
+		MinReplicas:  2,
+		MaxReplicas:  5,
+		TargetCPU:    70,
+		TargetMemory: 85,
+	}))
+	ValidateReplicasOwnedByHPA(t, objects, delegateName)
+}
+
+func TestDelegateAutoscaling(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	namespaceName := testNamespace.Name
+
+	// replicas is below min_replicas, so the HPA has to scale the Deployment up
+	replicas := 1
+	minReplicas := 2
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas": replicas,
+		"autoscaling": map[string]interface{}{
+			"min_replicas": minReplicas,
+			"max_replicas": 4,
+		},
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Get the Kubernetes config path
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Validate the live HPA
+	hpa := GetHorizontalPodAutoscaler(t, kubectlOptions, delegateName)
+	assert.Empty(t, CheckHorizontalPodAutoscaler(*hpa, AutoscalingExpectation{
+		Deployment:  delegateName,
+		MinReplicas: int32(minReplicas),
+		MaxReplicas: 4,
+		TargetCPU:   80,
+	}))
+
+	// Wait for the HPA to bring the Deployment to min_replicas
+	waitForReplicas := func() {
+		retry.DoWithRetry(t, "Waiting for the HPA to scale the delegate", 20, 15*time.Second, func() (string, error) {
+			deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+			if *deployment.Spec.Replicas < int32(minReplicas) || deployment.Status.AvailableReplicas < int32(minReplicas) {
+				return "", fmt.Errorf("deployment has %d/%d replicas available", deployment.Status.AvailableReplicas, *deployment.Spec.Replicas)
+			}
+			return "", nil
+		})
+	}
+	waitForReplicas()
+
+	// Terraform must not try to take the replica count back from the HPA
+	ValidateNoDrift(t, terraformOptions)
+
+	// The helm provider does not diff the live replica count, so only a helm upgrade could reset
+	// it. Change an unrelated input to force one.
+	helmOptions := &helm.Options{KubectlOptions: kubectlOptions}
+	revision := func() string {
+		for _, release := range ListHelmReleases(t, helmOptions, namespaceName) {
+			if release.Name == delegateName {
+				return release.Revision
+			}
+		}
+		require.Failf(t, "Release not found", "Helm release %s is not in %s", delegateName, namespaceName)
+		return ""
+	}
+	before := revision()
+
+	terraformOptions.Vars["common_annotations"] = map[string]string{"harness-delegate-test/reapply": "1"}
+	terraform.Apply(t, terraformOptions)
+	require.NotEqual(t, before, revision(), "Changing common_annotations should upgrade the release")
+
+	// Read right after the upgrade, before the HPA could scale a reset Deployment back up
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	require.GreaterOrEqual(t, *deployment.Spec.Replicas, int32(minReplicas), "Upgrading the release should keep the HPA's replica count rather than reset it to var.replicas")
+	waitForReplicas()
+}
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CABundleMountPath is where the module mounts the custom CA bundle in the delegate container
+const CABundleMountPath = "/opt/harness-delegate/ca-bundle"
+
+// CABundleDestinationPaths are the system bundle files the module lists in DESTINATION_CA_PATH,
+// which the delegate adds the mounted certificates to at startup
+var CABundleDestinationPaths = []string{"/etc/ssl/certs/ca-bundle.crt", "/etc/pki/tls/certs/ca-bundle.crt"}
+
+// javaTrustStoreCommand lists the JVM's default trust store as PEM, where the delegate also adds
+// the mounted certificates
+const javaTrustStoreCommand = "keytool -list -rfc -cacerts -storepass changeit"
+
+// CABundleRef identifies the Secret or ConfigMap holding the CA bundle
+type CABundleRef struct {
+	SecretName    string
+	ConfigMapName string
+	Key           string
+}
+
+// TestCA is a locally generated CA together with a server certificate it signed
+type TestCA struct {
+	// CertPEM is the PEM encoded CA certificate, i.e. the bundle to trust
+	CertPEM []byte
+	// ServerCert is valid for localhost and 127.0.0.1
+	ServerCert tls.Certificate
+}
+
+// GenerateTestCA creates a self-signed CA and a server certificate for localhost signed by it
+func GenerateTestCA(t *testing.T) TestCA {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "harness-delegate-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	return TestCA{
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		ServerCert: tls.Certificate{
+			Certificate: [][]byte{serverDER},
+			PrivateKey:  serverKey,
+		},
+	}
+}
+
+// VerifyCABundleTrust makes an HTTPS request to url trusting only the certificates in bundle
+func VerifyCABundleTrust(bundle []byte, url string) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return fmt.Errorf("CA bundle contains no PEM certificates")
+	}
+
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// ValidateCABundleWiring validates that the CA bundle is mounted into the container and that
+// the delegate is told to add it to the trust store
+func ValidateCABundleWiring(t *testing.T, workload WorkloadPodSpec, container corev1.Container, envMap map[string]string, ref CABundleRef) {
+	var volumeName string
+	for _, volume := range workload.Template.Spec.Volumes {
+		var items []corev1.KeyToPath
+		switch {
+		case ref.SecretName != "" && volume.Secret != nil && volume.Secret.SecretName == ref.SecretName:
+			items = volume.Secret.Items
+		case ref.ConfigMapName != "" && volume.ConfigMap != nil && volume.ConfigMap.Name == ref.ConfigMapName:
+			items = volume.ConfigMap.Items
+		default:
+			continue
+		}
+		for _, item := range items {
+			if item.Key == ref.Key {
+				volumeName = volume.Name
+			}
+		}
+	}
+	require.NotEmpty(t, volumeName, "%s should have a volume projecting key %s of the CA bundle", workload, ref.Key)
+
+	var mounted bool
+	for _, mount := range container.VolumeMounts {
+		if mount.Name == volumeName && strings.TrimSuffix(mount.MountPath, "/") == CABundleMountPath {
+			mounted = true
+		}
+	}
+	require.True(t, mounted, "Container %s should mount the CA bundle at %s", container.Name, CABundleMountPath)
+
+	require.Equal(t, strings.Join(CABundleDestinationPaths, ","), envMap["DESTINATION_CA_PATH"], "DESTINATION_CA_PATH should list the trust stores to add the bundle to")
+}
+
+// ContainsCertificate reports whether the PEM bundle holds the first certificate of certPEM.
+// Blocks other than certificates, such as keytool's headers, are skipped.
+func ContainsCertificate(bundle, certPEM []byte) (bool, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return false, fmt.Errorf("no PEM certificate to look for")
+	}
+	for rest := bundle; ; {
+		var found *pem.Block
+		found, rest = pem.Decode(rest)
+		if found == nil {
+			return false, nil
+		}
+		if found.Type == "CERTIFICATE" && bytes.Equal(found.Bytes, block.Bytes) {
+			return true, nil
+		}
+	}
+}
+
+// ValidateCABundleTrustedInPod validates, from inside the delegate container, that the CA reached
+// every DESTINATION_CA_PATH bundle file and the JVM trust store
+func ValidateCABundleTrustedInPod(t *testing.T, kubectlOptions *k8s.KubectlOptions, pod corev1.Pod, container string, ca TestCA) {
+	exec := func(command ...string) string {
+		args := append([]string{"exec", pod.Name, "-c", container, "--"}, command...)
+		output, err := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, args...)
+		require.NoError(t, err, "Running %v in %s", command, pod.Name)
+		return output
+	}
+
+	for _, path := range CABundleDestinationPaths {
+		found, err := ContainsCertificate([]byte(exec("cat", path)), ca.CertPEM)
+		require.NoError(t, err)
+		require.True(t, found, "%s in %s should hold the custom CA", path, pod.Name)
+	}
+
+	found, err := ContainsCertificate([]byte(exec("sh", "-c", javaTrustStoreCommand)), ca.CertPEM)
+	require.NoError(t, err)
+	require.True(t, found, "The JVM trust store in %s should hold the custom CA", pod.Name)
+}
@@ -0,0 +1,186 @@
+package test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// startHTTPSStandIn serves HTTPS with a certificate signed by the test CA
+func startHTTPSStandIn(t *testing.T, ca TestCA) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{ca.ServerCert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVerifyCABundleTrust(t *testing.T) {
+	ca := GenerateTestCA(t)
+	otherCA := GenerateTestCA(t)
+	server := startHTTPSStandIn(t, ca)
+
+	assert.NoError(t, VerifyCABundleTrust(ca.CertPEM, server.URL), "Request should succeed when the bundle is trusted")
+	assert.Error(t, VerifyCABundleTrust(otherCA.CertPEM, server.URL), "Request should fail with an unrelated CA")
+	assert.Error(t, VerifyCABundleTrust([]byte("not a certificate"), server.URL), "Request should fail with an empty bundle")
+}
+
+func TestContainsCertificate(t *testing.T) {
+	ca := GenerateTestCA(t)
+	otherCA := GenerateTestCA(t)
+
+	// keytool -list -rfc prints aliases and headers between the certificates
+	listing := "Keystore type: PKCS12\n\nAlias name: other\n" + string(otherCA.CertPEM) + "\nAlias name: custom\n" + string(ca.CertPEM)
+	found, err := ContainsCertificate([]byte(listing), ca.CertPEM)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = ContainsCertificate(otherCA.CertPEM, ca.CertPEM)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = ContainsCertificate(ca.CertPEM, []byte("not a certificate"))
+	assert.Error(t, err)
+}
+
+func TestRenderedDelegateCABundle(t *testing.T) {
+	testCases := []struct {
+		name string
+		vars map[string]interface{}
+		ref  CABundleRef
+	}{
+		{
+			name: "secret",
+			vars: map[string]interface{}{"ca_bundle_secret_name": "corporate-ca"},
+			ref:  CABundleRef{SecretName: "corporate-ca", Key: "ca.bundle"},
+		},
+		{
+			name: "configmap",
+			vars: map[string]interface{}{"ca_bundle_configmap_name": "corporate-ca", "ca_bundle_key": "ca.crt"},
+			ref:  CABundleRef{ConfigMapName: "corporate-ca", Key: "ca.crt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+			vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+			for key, value := range tc.vars {
+				vars[key] = value
+			}
+
+			objects, err := ParseManifest(RenderDelegateManifest(t, &terraform.Options{
+				TerraformDir: CopyModuleDir(t),
+				Vars:         vars,
+			}))
+			require.NoError(t, err)
+			workloads, err := PodSpecsFromManifest(objects)
+			require.NoError(t, err)
+
+			delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+			container := delegate.Template.Spec.Containers[0]
+			ValidateCABundleWiring(t, delegate, container, ResolveRenderedEnvMap(t, objects, container), tc.ref)
+		})
+	}
+}
+
+func TestRenderedDelegateCustomListsOverlay(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+	delete(vars, "delegate_token")
+	vars["existing_delegate_token_secret_name"] = "delegate-token"
+	vars["ca_bundle_secret_name"] = "corporate-ca"
+	vars["values"] = LoadValuesOverlay(t, "custom-lists.yaml")
+
+	objects, err := ParseManifest(RenderDelegateManifest(t, &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	}))
+	require.NoError(t, err)
+	workloads, err := PodSpecsFromManifest(objects)
+	require.NoError(t, err)
+
+	// The overlay's lists are appended to the module's, not merged over them
+	delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+	container := delegate.Template.Spec.Containers[0]
+	envMap := ResolveRenderedEnvMap(t, objects, container)
+	ValidateCABundleWiring(t, delegate, container, envMap, CABundleRef{SecretName: "corporate-ca", Key: "ca.bundle"})
+	require.NotNil(t, tokenSecretRef(container), "DELEGATE_TOKEN should still come from the existing Secret")
+	assert.Equal(t, "kept", envMap["EXTRA_MARKER"])
+
+	var volumes, mounts []string
+	for _, volume := range delegate.Template.Spec.Volumes {
+		volumes = append(volumes, volume.Name)
+	}
+	for _, mount := range container.VolumeMounts {
+		mounts = append(mounts, mount.MountPath)
+	}
+	assert.Contains(t, volumes, "extra-scratch")
+	assert.Contains(t, mounts, "/opt/harness-delegate/extra-scratch")
+}
+
+func TestDelegateWithCABundle(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := strings.ToLower(random.UniqueId())
+	delegateName := fmt.Sprintf("test-delegate-%s", uniqueID)
+	replicas := 1
+	secretName := "corporate-ca"
+
+	// Create the namespace and the CA bundle Secret out-of-band
+	ca := GenerateTestCA(t)
+	testNamespace := AllocateNamespace(t, "harness-delegate-ca")
+	kubectlOptions := testNamespace.KubectlOptions
+
+	_, err := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, "create", "secret", "generic", secretName,
+		"--from-literal=ca.bundle="+string(ca.CertPEM))
+	require.NoError(t, err)
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas":              replicas,
+		"ca_bundle_secret_name": secretName,
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Getting pod list
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	require.Equal(t, replicas, len(pods), "expected number of pods")
+
+	// Validate the bundle is mounted and wired into the trust store configuration
+	pod := pods[0]
+	container := pod.Spec.Containers[0]
+	envMap := ResolveContainerEnvMap(t, kubectlOptions, container)
+	ValidateCABundleWiring(t, PodSpecsFromPods(pods)[0], container, envMap, CABundleRef{SecretName: secretName, Key: "ca.bundle"})
+
+	// The delegate must have added the CA to the system bundles and the JVM trust store
+	ValidateCABundleTrustedInPod(t, kubectlOptions, pod, container.Name, ca)
+
+	// The bundle the delegate sees must be the one that makes the HTTPS stand-in trusted
+	mounted, err := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, "exec", pod.Name, "-c", container.Name, "--",
+		"cat", CABundleMountPath+"/ca.bundle")
+	require.NoError(t, err)
+	server := startHTTPSStandIn(t, ca)
+	require.NoError(t, VerifyCABundleTrust([]byte(mounted), server.URL), "Mounted CA bundle should trust the HTTPS stand-in")
+}
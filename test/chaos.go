@@ -0,0 +1,191 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RecoveryMetrics records what a chaos scenario disrupted and how long the delegate took to recover
+type RecoveryMetrics struct {
+	Scenario string   `json:"scenario"`
+	Killed   []string `json:"killed"`
+	// KilledAt is when the last pod deletion was accepted by the API server
+	KilledAt    time.Time     `json:"killedAt"`
+	RecoveredAt time.Time     `json:"recoveredAt"`
+	Recovery    time.Duration `json:"-"`
+	// RecoverySeconds is Recovery in seconds, for machine consumption
+	RecoverySeconds     float64  `json:"recoverySeconds"`
+	StuckTerminating    []string `json:"stuckTerminating"`
+	OrphanedReplicaSets []string `json:"orphanedReplicaSets"`
+}
+
+// KillPods deletes the pods with the given grace period. A grace period of 0 removes them
+// immediately, as when their node is lost. Returns the time the last deletion was accepted.
+func KillPods(t *testing.T, kubectlOptions *k8s.KubectlOptions, pods []corev1.Pod, gracePeriodSeconds int64) time.Time {
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+
+	for _, pod := range pods {
+		err := client.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: &gracePeriodSeconds,
+		})
+		require.NoError(t, err, "Deleting pod %s", pod.Name)
+	}
+	return time.Now()
+}
+
+// WaitForDeploymentRecovery waits until the Deployment is Available again with all its replicas
+// replaced by pods other than the killed ones, and returns the recovery time since killedAt
+func WaitForDeploymentRecovery(t *testing.T, kubectlOptions *k8s.KubectlOptions, deploymentName string, killed []string, killedAt time.Time, retries int, sleepBetweenRetries time.Duration) time.Duration {
+	killedNames := make(map[string]bool, len(killed))
+	for _, name := range killed {
+		killedNames[name] = true
+	}
+
+	retry.DoWithRetry(t, fmt.Sprintf("Waiting for Deployment %s to recover", deploymentName), retries, sleepBetweenRetries, func() (string, error) {
+		deployment, err := k8s.GetDeploymentE(t, kubectlOptions, deploymentName)
+		if err != nil {
+			return "", err
+		}
+		replicas := *deployment.Spec.Replicas
+		if deployment.Status.AvailableReplicas < replicas || !deploymentAvailable(deployment) {
+			return "", fmt.Errorf("%d/%d replicas available", deployment.Status.AvailableReplicas, replicas)
+		}
+
+		pods, err := k8s.ListPodsE(t, kubectlOptions, metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector)})
+		if err != nil {
+			return "", err
+		}
+		var replaced int32
+		for _, pod := range pods {
+			if !killedNames[pod.Name] && pod.DeletionTimestamp == nil && countReadyPods([]corev1.Pod{pod}) == 1 {
+				replaced++
+			}
+		}
+		if replaced < replicas {
+			return "", fmt.Errorf("%d/%d replacement pods Ready", replaced, replicas)
+		}
+		return "", nil
+	})
+
+	return time.Since(killedAt)
+}
+
+// StuckTerminatingPods returns the pods that have been terminating for longer than their grace
+// period plus slack
+func StuckTerminatingPods(pods []corev1.Pod, now time.Time, slack time.Duration) []string {
+	var stuck []string
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			continue
+		}
+		deadline := pod.DeletionTimestamp.Time.Add(slack)
+		if now.After(deadline) {
+			stuck = append(stuck, pod.Name)
+		}
+	}
+	sort.Strings(stuck)
+	return stuck
+}
+
+// OrphanedReplicaSets returns the ReplicaSets that have no controlling Deployment among
+// deployments, or that still run pods although they are not the Deployment's current revision
+func OrphanedReplicaSets(replicaSets []appsv1.ReplicaSet, deployments []appsv1.Deployment) []string {
+	owners := make(map[string]appsv1.Deployment, len(deployments))
+	for _, deployment := range deployments {
+		owners[string(deployment.UID)] = deployment
+	}
+
+	var orphaned []string
+	for _, replicaSet := range replicaSets {
+		var deployment appsv1.Deployment
+		var ok bool
+		owner := metav1.GetControllerOf(&replicaSet)
+		if owner != nil && owner.Kind == "Deployment" {
+			deployment, ok = owners[string(owner.UID)]
+		}
+		switch {
+		case !ok:
+			orphaned = append(orphaned, replicaSet.Name)
+		case replicaSet.Status.Replicas > 0 && replicaSet.Annotations["deployment.kubernetes.io/revision"] != deployment.Annotations["deployment.kubernetes.io/revision"]:
+			orphaned = append(orphaned, replicaSet.Name)
+		}
+	}
+	sort.Strings(orphaned)
+	return orphaned
+}
+
+// ValidateNoChaosResidue fills in and asserts the residue metrics over every selector: no pod
+// stuck terminating and no orphaned ReplicaSet in the namespace. Every selector is checked before
+// asserting, so that the metrics hold all of them.
+func ValidateNoChaosResidue(t *testing.T, kubectlOptions *k8s.KubectlOptions, metrics *RecoveryMetrics, selectors ...string) {
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+	deployments, err := client.AppsV1().Deployments(kubectlOptions.Namespace).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	for _, selector := range selectors {
+		pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{LabelSelector: selector})
+		metrics.StuckTerminating = append(metrics.StuckTerminating, StuckTerminatingPods(pods, time.Now(), 30*time.Second)...)
+
+		replicaSets, err := client.AppsV1().ReplicaSets(kubectlOptions.Namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+		require.NoError(t, err)
+		metrics.OrphanedReplicaSets = append(metrics.OrphanedReplicaSets, OrphanedReplicaSets(replicaSets.Items, deployments.Items)...)
+	}
+
+	require.Empty(t, metrics.StuckTerminating, "No pod should be stuck terminating")
+	require.Empty(t, metrics.OrphanedReplicaSets, "No ReplicaSet should be orphaned")
+}
+
+// TriggerCronJob creates a Job from a CronJob, as `kubectl create job --from=cronjob/...` does,
+// and returns the Job name
+func TriggerCronJob(t *testing.T, kubectlOptions *k8s.KubectlOptions, cronJobName string) string {
+	// Job names end up in the job-name label, which is limited to 63 characters
+	prefix := cronJobName
+	if len(prefix) > 48 {
+		prefix = strings.TrimSuffix(prefix[:48], "-")
+	}
+	jobName := fmt.Sprintf("%s-chaos-%s", prefix, strings.ToLower(random.UniqueId()))
+	k8s.RunKubectl(t, kubectlOptions, "create", "job", jobName, "--from=cronjob/"+cronJobName)
+	return jobName
+}
+
+// WaitForJobPodRunning waits for a pod of the Job to be Running and returns it
+func WaitForJobPodRunning(t *testing.T, kubectlOptions *k8s.KubectlOptions, jobName string, retries int, sleepBetweenRetries time.Duration) corev1.Pod {
+	var running corev1.Pod
+	retry.DoWithRetry(t, fmt.Sprintf("Waiting for a pod of Job %s to run", jobName), retries, sleepBetweenRetries, func() (string, error) {
+		pods, err := k8s.ListPodsE(t, kubectlOptions, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+		if err != nil {
+			return "", err
+		}
+		for _, pod := range pods {
+			if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+				running = pod
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("no running pod for Job %s", jobName)
+	})
+	return running
+}
+
+func deploymentAvailable(deployment *appsv1.Deployment) bool {
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestStuckTerminatingPods(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pod := func(name string, deletedAgo time.Duration) corev1.Pod {
+		pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if deletedAgo > 0 {
+			deleted := metav1.NewTime(now.Add(-deletedAgo))
+			pod.DeletionTimestamp = &deleted
+		}
+		return pod
+	}
+
+	stuck := StuckTerminatingPods([]corev1.Pod{pod("running", 0), pod("terminating", 10*time.Second), pod("stuck", 5*time.Minute)}, now, 30*time.Second)
+	assert.Equal(t, []string{"stuck"}, stuck)
+}
+
+func TestOrphanedReplicaSets(t *testing.T) {
+	controller := true
+	deployment := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "delegate",
+		UID:         types.UID("deployment-uid"),
+		Annotations: map[string]string{"deployment.kubernetes.io/revision": "2"},
+	}}
+	replicaSet := func(name, ownerUID, revision string, replicas int32) appsv1.ReplicaSet {
+		replicaSet := appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{"deployment.kubernetes.io/revision": revision}},
+			Status:     appsv1.ReplicaSetStatus{Replicas: replicas},
+		}
+		if ownerUID != "" {
+			replicaSet.OwnerReferences = []metav1.OwnerReference{{Kind: "Deployment", Name: "delegate", UID: types.UID(ownerUID), Controller: &controller}}
+		}
+		return replicaSet
+	}
+
+	orphaned := OrphanedReplicaSets([]appsv1.ReplicaSet{
+		replicaSet("current", "deployment-uid", "2", 2),
+		replicaSet("previous-scaled-down", "deployment-uid", "1", 0),
+		replicaSet("previous-still-running", "deployment-uid", "1", 1),
+		replicaSet("no-owner", "", "1", 1),
+		replicaSet("deleted-owner", "gone-uid", "1", 0),
+	}, []appsv1.Deployment{deployment})
+	assert.Equal(t, []string{"deleted-owner", "no-owner", "previous-still-running"}, orphaned)
+}
+
+func TestDelegateChaosRecovery(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	replicas := 2
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas":         replicas,
+		"upgrader_enabled": true,
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Get the Kubernetes config path
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	selector := metav1.FormatLabelSelector(deployment.Spec.Selector)
+	// Pods killed by the previous scenario may still be terminating within their grace period
+	listPods := func() []corev1.Pod {
+		pods := ActivePods(k8s.ListPods(t, kubectlOptions, metav1.ListOptions{LabelSelector: selector}))
+		require.Equal(t, replicas, len(pods), "expected number of pods")
+		return pods
+	}
+
+	// Scenarios run in order against the same release, each starting from a recovered Deployment
+	scenarios := []struct {
+		name   string
+		victim func(pods []corev1.Pod) []corev1.Pod
+		grace  int64
+	}{
+		{name: "kill one pod", victim: func(pods []corev1.Pod) []corev1.Pod { return pods[:1] }, grace: 30},
+		{name: "node loss", victim: func(pods []corev1.Pod) []corev1.Pod { return pods }, grace: 0},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			victims := scenario.victim(listPods())
+			metrics := RecoveryMetrics{Scenario: scenario.name}
+			// Written even when the pods never recover
+			defer WriteJSONReport(t, "chaos", &metrics)
+			for _, pod := range victims {
+				metrics.Killed = append(metrics.Killed, pod.Name)
+			}
+
+			metrics.KilledAt = KillPods(t, kubectlOptions, victims, scenario.grace)
+			metrics.Recovery = WaitForDeploymentRecovery(t, kubectlOptions, delegateName, metrics.Killed, metrics.KilledAt, 40, 15*time.Second)
+			metrics.RecoveredAt = metrics.KilledAt.Add(metrics.Recovery)
+			metrics.RecoverySeconds = metrics.Recovery.Seconds()
+
+			ValidateNoChaosResidue(t, kubectlOptions, &metrics, selector)
+		})
+	}
+
+	t.Run("kill upgrader job mid-run", func(t *testing.T) {
+		jobName := TriggerCronJob(t, kubectlOptions, fmt.Sprintf("%s-upgrader-job", delegateName))
+		defer k8s.RunKubectl(t, kubectlOptions, "delete", "job", jobName, "--ignore-not-found")
+
+		victim := WaitForJobPodRunning(t, kubectlOptions, jobName, 20, 5*time.Second)
+		metrics := RecoveryMetrics{Scenario: "kill upgrader job mid-run", Killed: []string{victim.Name}}
+		defer WriteJSONReport(t, "chaos", &metrics)
+		metrics.KilledAt = KillPods(t, kubectlOptions, []corev1.Pod{victim}, 0)
+
+		// The delegate must stay (or become again) Available while the upgrader is disrupted
+		metrics.Recovery = WaitForDeploymentRecovery(t, kubectlOptions, delegateName, nil, metrics.KilledAt, 40, 15*time.Second)
+		metrics.RecoveredAt = metrics.KilledAt.Add(metrics.Recovery)
+		metrics.RecoverySeconds = metrics.Recovery.Seconds()
+
+		ValidateNoChaosResidue(t, kubectlOptions, &metrics, "job-name="+jobName, selector)
+	})
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// ClusterTarget is the cluster a test runs against, as a kubeconfig path and context. It feeds
+// both the helm provider, through KUBE_CONFIG_PATH and KUBE_CTX, and the kubectl and Helm helpers,
+// through their KubectlOptions.
+type ClusterTarget struct {
+	KubeconfigPath string
+	// Context is the kubeconfig context, the current context if empty
+	Context string
+}
+
+// Name returns the context, for subtest names
+func (c ClusterTarget) Name() string {
+	if c.Context == "" {
+		return "current-context"
+	}
+	return c.Context
+}
+
+// expandHome expands a leading ~, as the helm provider does for KUBE_CONFIG_PATH
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
+
+// DefaultClusterTarget returns the target from KUBE_CONFIG_PATH and KUBE_CTX, the variables the
+// helm provider reads. Without KUBE_CONFIG_PATH, KUBECONFIG and then ~/.kube/config are used.
+func DefaultClusterTarget() ClusterTarget {
+	path := os.Getenv("KUBE_CONFIG_PATH")
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" {
+		path = "~/.kube/config"
+	}
+	return ClusterTarget{KubeconfigPath: expandHome(path), Context: os.Getenv("KUBE_CTX")}
+}
+
+// ClusterTargets returns one target per context of the comma-separated KUBE_CONTEXTS, all sharing
+// the default kubeconfig, or just the DefaultClusterTarget
+func ClusterTargets() []ClusterTarget {
+	defaultTarget := DefaultClusterTarget()
+	var targets []ClusterTarget
+	for _, context := range strings.Split(os.Getenv("KUBE_CONTEXTS"), ",") {
+		if context = strings.TrimSpace(context); context != "" {
+			targets = append(targets, ClusterTarget{KubeconfigPath: defaultTarget.KubeconfigPath, Context: context})
+		}
+	}
+	if len(targets) == 0 {
+		targets = append(targets, defaultTarget)
+	}
+	return targets
+}
+
+// ForEachClusterTarget runs the scenario as one subtest per ClusterTargets entry
+func ForEachClusterTarget(t *testing.T, scenario func(t *testing.T, target ClusterTarget)) {
+	for _, target := range ClusterTargets() {
+		target := target
+		t.Run(target.Name(), func(t *testing.T) {
+			scenario(t, target)
+		})
+	}
+}
+
+// KubectlOptions returns the options for the kubectl and Helm helpers on the namespace
+func (c ClusterTarget) KubectlOptions(namespace string) *k8s.KubectlOptions {
+	return k8s.NewKubectlOptions(c.Context, c.KubeconfigPath, namespace)
+}
+
+// ConfigureTerraform points the helm provider at the target and validates that Terraform then
+// reaches the same API server as the kubectl options the test's helpers use
+func (c ClusterTarget) ConfigureTerraform(t *testing.T, terraformOptions *terraform.Options, helpers *k8s.KubectlOptions) {
+	if terraformOptions.EnvVars == nil {
+		terraformOptions.EnvVars = make(map[string]string)
+	}
+	terraformOptions.EnvVars["KUBE_CONFIG_PATH"] = c.KubeconfigPath
+	terraformOptions.EnvVars["KUBE_CTX"] = c.Context
+
+	ValidateSameAPIServer(t, terraformOptions, helpers)
+}
+
+// terraformEnv returns the value of an environment variable as the Terraform process sees it
+func terraformEnv(terraformOptions *terraform.Options, name string) string {
+	if value, ok := terraformOptions.EnvVars[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// normalizeServer drops the default port and trailing slash of an API server URL
+func normalizeServer(server string) string {
+	parsed, err := url.Parse(server)
+	if err != nil || parsed.Host == "" {
+		return strings.TrimSuffix(server, "/")
+	}
+	if parsed.Port() == "443" && parsed.Scheme == "https" {
+		parsed.Host = parsed.Hostname()
+	}
+	return strings.TrimSuffix(parsed.Scheme+"://"+parsed.Host+parsed.Path, "/")
+}
+
+// TerraformAPIServer returns the client configuration the helm provider builds from the Terraform
+// environment, options.EnvVars over the process environment. The provider's explicit KUBE_HOST
+// takes precedence over its kubeconfig, and carries no credentials here.
+func TerraformAPIServer(terraformOptions *terraform.Options) (*rest.Config, error) {
+	if host := terraformEnv(terraformOptions, "KUBE_HOST"); host != "" {
+		return &rest.Config{Host: host}, nil
+	}
+	configPath := expandHome(terraformEnv(terraformOptions, "KUBE_CONFIG_PATH"))
+	if configPath == "" {
+		return nil, fmt.Errorf("the helm provider needs KUBE_CONFIG_PATH or KUBE_HOST")
+	}
+	return k8s.LoadApiClientConfigE(configPath, terraformEnv(terraformOptions, "KUBE_CTX"))
+}
+
+// CheckSameAPIServer returns an error if the helm provider and kubectl API server URLs differ
+func CheckSameAPIServer(terraformServer, kubectlServer string) error {
+	if normalizeServer(terraformServer) != normalizeServer(kubectlServer) {
+		return fmt.Errorf("the helm provider targets %s but kubectl targets %s", terraformServer, kubectlServer)
+	}
+	return nil
+}
+
+// clusterIdentity returns the UID of the kube-system namespace, which tells apart clusters behind
+// the same URL, e.g. local clusters recreated between runs
+func clusterIdentity(client kubernetes.Interface) (string, error) {
+	namespace, err := client.CoreV1().Namespaces().Get(context.Background(), metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(namespace.UID), nil
+}
+
+// ValidateSameAPIServer validates that the helm provider, configured from the Terraform
+// environment, and the kubectl options target the same cluster: the same API server and, when the
+// provider uses a kubeconfig, the same kube-system namespace
+func ValidateSameAPIServer(t *testing.T, terraformOptions *terraform.Options, kubectlOptions *k8s.KubectlOptions) {
+	kubectlConfigPath, err := kubectlOptions.GetConfigPath(t)
+	require.NoError(t, err)
+	kubectlConfig, err := k8s.LoadApiClientConfigE(kubectlConfigPath, kubectlOptions.ContextName)
+	require.NoError(t, err, "Loading the kubectl configuration")
+	terraformConfig, err := TerraformAPIServer(terraformOptions)
+	require.NoError(t, err, "Loading the helm provider configuration")
+
+	require.NoError(t, CheckSameAPIServer(terraformConfig.Host, kubectlConfig.Host),
+		"KUBE_CONFIG_PATH %q and KUBE_CTX %q for Terraform, %q and context %q for kubectl",
+		terraformEnv(terraformOptions, "KUBE_CONFIG_PATH"), terraformEnv(terraformOptions, "KUBE_CTX"),
+		kubectlConfigPath, kubectlOptions.ContextName)
+
+	if terraformEnv(terraformOptions, "KUBE_HOST") != "" {
+		return
+	}
+	terraformClient, err := kubernetes.NewForConfig(terraformConfig)
+	require.NoError(t, err)
+	kubectlClient, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+
+	terraformIdentity, err := clusterIdentity(terraformClient)
+	require.NoError(t, err, "Reaching the helm provider's cluster at %s", terraformConfig.Host)
+	kubectlIdentity, err := clusterIdentity(kubectlClient)
+	require.NoError(t, err, "Reaching the kubectl cluster at %s", kubectlConfig.Host)
+	require.Equal(t, kubectlIdentity, terraformIdentity, "The helm provider and kubectl reach different clusters at %s", terraformConfig.Host)
+}
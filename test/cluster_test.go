@@ -0,0 +1,108 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const twoClusterKubeconfig = `apiVersion: v1
+kind: Config
+current-context: blue
+clusters:
+- name: blue
+  cluster:
+    server: https://blue.example.com:443/
+- name: green
+  cluster:
+    server: https://green.example.com:6443
+contexts:
+- name: blue
+  context:
+    cluster: blue
+    user: tester
+- name: green
+  context:
+    cluster: green
+    user: tester
+users:
+- name: tester
+  user:
+    token: not-a-real-token
+`
+
+func writeKubeconfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(twoClusterKubeconfig), 0600))
+	return path
+}
+
+func TestClusterTargets(t *testing.T) {
+	path := writeKubeconfig(t)
+	t.Setenv("KUBE_CONFIG_PATH", path)
+	t.Setenv("KUBECONFIG", "/elsewhere/config")
+	t.Setenv("KUBE_CTX", "")
+	t.Setenv("KUBE_CONTEXTS", "")
+
+	// KUBE_CONFIG_PATH wins over KUBECONFIG, as for the helm provider
+	target := DefaultClusterTarget()
+	assert.Equal(t, ClusterTarget{KubeconfigPath: path}, target)
+	assert.Equal(t, "current-context", target.Name())
+	assert.Equal(t, []ClusterTarget{target}, ClusterTargets())
+
+	t.Setenv("KUBE_CONTEXTS", "blue, green,")
+	assert.Equal(t, []ClusterTarget{
+		{KubeconfigPath: path, Context: "blue"},
+		{KubeconfigPath: path, Context: "green"},
+	}, ClusterTargets())
+
+	t.Setenv("KUBE_CONFIG_PATH", "")
+	assert.Equal(t, "/elsewhere/config", DefaultClusterTarget().KubeconfigPath)
+
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	t.Setenv("KUBE_CONFIG_PATH", "~/.kube/other")
+	assert.Equal(t, filepath.Join(home, ".kube/other"), DefaultClusterTarget().KubeconfigPath)
+}
+
+func TestTerraformAPIServer(t *testing.T) {
+	path := writeKubeconfig(t)
+	t.Setenv("KUBE_CONFIG_PATH", "/elsewhere/config")
+	t.Setenv("KUBE_CTX", "")
+	t.Setenv("KUBE_HOST", "")
+
+	// The options' EnvVars override the process environment
+	options := &terraform.Options{EnvVars: map[string]string{"KUBE_CONFIG_PATH": path}}
+	config, err := TerraformAPIServer(options)
+	require.NoError(t, err)
+	assert.Equal(t, "https://blue.example.com:443/", config.Host)
+
+	options.EnvVars["KUBE_CTX"] = "green"
+	config, err = TerraformAPIServer(options)
+	require.NoError(t, err)
+	assert.Equal(t, "https://green.example.com:6443", config.Host)
+
+	// The kubectl side sees the same cluster through the target
+	kubectlOptions := ClusterTarget{KubeconfigPath: path, Context: "green"}.KubectlOptions("ns")
+	assert.Equal(t, "green", kubectlOptions.ContextName)
+	assert.Equal(t, "ns", kubectlOptions.Namespace)
+
+	t.Setenv("KUBE_HOST", "https://explicit.example.com")
+	config, err = TerraformAPIServer(options)
+	require.NoError(t, err)
+	assert.Equal(t, "https://explicit.example.com", config.Host)
+
+	_, err = TerraformAPIServer(&terraform.Options{EnvVars: map[string]string{"KUBE_HOST": "", "KUBE_CONFIG_PATH": ""}})
+	assert.Error(t, err)
+}
+
+func TestCheckSameAPIServer(t *testing.T) {
+	assert.NoError(t, CheckSameAPIServer("https://blue.example.com:443/", "https://blue.example.com"))
+	assert.NoError(t, CheckSameAPIServer("https://10.0.0.1:6443", "https://10.0.0.1:6443/"))
+	assert.Error(t, CheckSameAPIServer("https://blue.example.com", "https://green.example.com:6443"))
+	assert.Error(t, CheckSameAPIServer("https://10.0.0.1:6443", "https://10.0.0.1:8443"))
+}
@@ -0,0 +1,118 @@
+// Command providermatrix runs the test suite once per helm provider version and reports which
+// versions pass. Each run gets HELM_PROVIDER_VERSION set, so that the suite pins the provider with
+// an override file in a staged copy of the module, and installs it from the -mirror directory
+// before the registries. Without -versions, every helm provider version found in the mirror is run.
+// The module requires the 3.x provider, so 2.x versions are expected to fail.
+//
+//	go run ./test/cmd/providermirror -dir /srv/provider-mirror -helm-versions 2.17.0,3.0.0,3.0.2
+//	go run ./test/cmd/providermatrix -mirror /srv/provider-mirror -versions 2.17.0,3.0.0,3.0.2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harness/terraform-kubernetes-harness-delegate/test"
+)
+
+// report is written to providers.json in the report directory
+type report struct {
+	Versions []test.SuiteResult `json:"versions"`
+	// Passing lists the versions whose run had no failed test
+	Passing []string `json:"passing"`
+	// Differences are the tests whose outcome differs between versions
+	Differences []string `json:"differences"`
+}
+
+func main() {
+	versions := flag.String("versions", os.Getenv(test.HelmProviderVersionsEnv), "comma-separated helm provider versions, defaults to the mirrored ones")
+	mirror := flag.String("mirror", os.Getenv(test.ProviderMirrorEnv), "filesystem provider mirror holding the versions")
+	pkg := flag.String("pkg", "./test/", "package holding the suite")
+	run := flag.String("run", "", "run only the tests matching this regular expression, e.g. TestRendered for the offline scenarios")
+	timeout := flag.String("timeout", "45m", "timeout of each suite run")
+	reports := flag.String("reports", filepath.Join("test", test.ReportDir()), "directory for the per-version reports")
+	flag.Parse()
+
+	ok, err := runAll(*versions, *mirror, *pkg, *run, *timeout, *reports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "providermatrix: %v\n", err)
+		os.Exit(1)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func runAll(versionList, mirror, pkg, run, timeout, reports string) (bool, error) {
+	if mirror == "" {
+		return false, fmt.Errorf("-mirror or %s is required", test.ProviderMirrorEnv)
+	}
+	mirror, err := filepath.Abs(mirror)
+	if err != nil {
+		return false, err
+	}
+	reports, err = filepath.Abs(reports)
+	if err != nil {
+		return false, err
+	}
+
+	mirrored, err := test.MirroredHelmProviderVersions(mirror)
+	if err != nil {
+		return false, err
+	}
+	var versions []string
+	for _, version := range strings.Split(versionList, ",") {
+		if version = strings.TrimSpace(version); version != "" {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		versions = mirrored
+	}
+	if len(versions) == 0 {
+		return false, fmt.Errorf("no helm provider versions found in %s", mirror)
+	}
+
+	var result report
+	ok := true
+	for _, version := range versions {
+		name := "helm-" + version
+		var versionRun test.SuiteResult
+		if !contains(mirrored, version) {
+			versionRun = test.SuiteResult{Name: name, Error: fmt.Sprintf("not in the mirror, which holds %v", mirrored)}
+		} else {
+			versionRun = test.RunSuite(test.SuiteRun{
+				Name:      name,
+				Package:   pkg,
+				Run:       run,
+				Timeout:   timeout,
+				ReportDir: filepath.Join(reports, name),
+				Env:       []string{test.HelmProviderVersionEnv + "=" + version, test.ProviderMirrorEnv + "=" + mirror},
+			})
+		}
+		versionRun.Version = version
+		if versionRun.OK() {
+			result.Passing = append(result.Passing, version)
+		} else {
+			ok = false
+		}
+		result.Versions = append(result.Versions, versionRun)
+	}
+	result.Differences = test.CompareSuiteResults(result.Versions)
+
+	test.PrintSuiteResults(os.Stdout, "PROVIDER", result.Versions, result.Differences)
+	fmt.Printf("passing helm provider versions: %s\n", strings.Join(result.Passing, ", "))
+	return ok, test.WriteSuiteReport(reports, "providers", result)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
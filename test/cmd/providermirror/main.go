@@ -0,0 +1,51 @@
+// Command providermirror builds the filesystem provider mirror used by hermetic runs (OFFLINE=1)
+// and by the helm provider matrix. It mirrors the providers the module selects and, with
+// -helm-versions, each of the given helm provider versions.
+//
+//	go run ./test/cmd/providermirror -dir /srv/provider-mirror -platforms linux_amd64 -helm-versions 2.17.0,3.0.0,3.0.2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/harness/terraform-kubernetes-harness-delegate/test"
+)
+
+func main() {
+	dir := flag.String("dir", os.Getenv(test.ProviderMirrorEnv), "mirror directory, defaults to PROVIDER_MIRROR_DIR")
+	module := flag.String("module", ".", "module directory")
+	binary := flag.String("binary", os.Getenv(test.IaCBinaryEnv), "terraform or tofu, defaults to IAC_BINARY or terratest's default")
+	platforms := flag.String("platforms", runtime.GOOS+"_"+runtime.GOARCH, "comma-separated platforms to mirror")
+	helmVersions := flag.String("helm-versions", os.Getenv(test.HelmProviderVersionsEnv), "comma-separated helm provider versions to mirror, defaults to the module's constraint")
+	flag.Parse()
+
+	if *dir == "" {
+		fmt.Fprintf(os.Stderr, "providermirror: -dir or %s is required\n", test.ProviderMirrorEnv)
+		os.Exit(1)
+	}
+	if err := test.BuildProviderMirrorE(*module, *dir, *binary, split(*platforms), split(*helmVersions)); err != nil {
+		fmt.Fprintf(os.Stderr, "providermirror: %v\n", err)
+		os.Exit(1)
+	}
+
+	versions, err := test.MirroredHelmProviderVersions(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "providermirror: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("mirrored helm provider versions in %s: %s\n", *dir, strings.Join(versions, ", "))
+}
+
+func split(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
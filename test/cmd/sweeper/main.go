@@ -0,0 +1,80 @@
+// Command sweeper deletes the test namespaces and Helm releases that test runs left behind, for
+// example when a run was killed before its cleanups could run. Resources are found by the labels
+// the test allocator puts on them and swept once older than -ttl.
+//
+//	go run ./test/cmd/sweeper -ttl 2h -dry-run
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/harness/terraform-kubernetes-harness-delegate/test"
+)
+
+func main() {
+	ttl := flag.Duration("ttl", 6*time.Hour, "sweep resources older than this")
+	dryRun := flag.Bool("dry-run", false, "list the leaked resources without deleting them")
+	// Default to the cluster the tests target
+	target := test.DefaultClusterTarget()
+	kubeconfig := flag.String("kubeconfig", target.KubeconfigPath, "path to the kubeconfig file, defaults to KUBE_CONFIG_PATH as for the tests")
+	kubeContext := flag.String("context", target.Context, "kubeconfig context to use, defaults to KUBE_CTX or the current context")
+	flag.Parse()
+
+	if err := run(*ttl, *dryRun, *kubeconfig, *kubeContext); err != nil {
+		fmt.Fprintf(os.Stderr, "sweeper: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ttl time.Duration, dryRun bool, kubeconfig, kubeContext string) error {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	leaked, err := test.FindLeakedResources(ctx, client, ttl, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, resource := range leaked {
+		fmt.Printf("%s (age %s)\n", resource, resource.Age.Round(time.Second))
+	}
+	if dryRun || len(leaked) == 0 {
+		fmt.Printf("%d leaked resources older than %s\n", len(leaked), ttl)
+		return nil
+	}
+
+	uninstall := func(namespace, release string) error {
+		args := []string{"uninstall", release, "--namespace", namespace}
+		if kubeconfig != "" {
+			args = append(args, "--kubeconfig", kubeconfig)
+		}
+		if kubeContext != "" {
+			args = append(args, "--kube-context", kubeContext)
+		}
+		cmd := exec.Command("helm", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+
+	failed, err := test.SweepLeakedResources(ctx, client, leaked, uninstall)
+	fmt.Printf("swept %d of %d leaked resources\n", len(leaked)-len(failed), len(leaked))
+	return err
+}
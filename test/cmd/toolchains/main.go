@@ -0,0 +1,84 @@
+// Command toolchains runs the test suite once per Terraform-compatible binary, e.g. terraform and
+// tofu, and reports the results of each binary and the tests whose outcome differs between them.
+// Each run gets IAC_BINARY set to its binary and its own report directory.
+//
+//	go run ./test/cmd/toolchains -binaries terraform,tofu -run 'TestRendered'
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harness/terraform-kubernetes-harness-delegate/test"
+)
+
+// report is written to toolchains.json in the report directory
+type report struct {
+	Binaries []test.SuiteResult `json:"binaries"`
+	// Differences are the tests whose outcome differs between binaries
+	Differences []string `json:"differences"`
+}
+
+func main() {
+	binaries := flag.String("binaries", envOr(test.IaCBinariesEnv, "terraform,tofu"), "comma-separated binaries to run the suite with")
+	pkg := flag.String("pkg", "./test/", "package holding the suite")
+	run := flag.String("run", "", "run only the tests matching this regular expression")
+	timeout := flag.String("timeout", "45m", "timeout of each suite run")
+	reports := flag.String("reports", filepath.Join("test", test.ReportDir()), "directory for the per-binary reports")
+	flag.Parse()
+
+	ok, err := runAll(strings.Split(*binaries, ","), *pkg, *run, *timeout, *reports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "toolchains: %v\n", err)
+		os.Exit(1)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func runAll(binaries []string, pkg, run, timeout, reports string) (bool, error) {
+	reports, err := filepath.Abs(reports)
+	if err != nil {
+		return false, err
+	}
+
+	var result report
+	ok := true
+	for _, binary := range binaries {
+		if binary = strings.TrimSpace(binary); binary == "" {
+			continue
+		}
+
+		var binaryRun test.SuiteResult
+		if version, err := test.IaCVersionE(binary); err != nil {
+			binaryRun = test.SuiteResult{Name: binary, Error: err.Error()}
+		} else {
+			binaryRun = test.RunSuite(test.SuiteRun{
+				Name:      binary,
+				Package:   pkg,
+				Run:       run,
+				Timeout:   timeout,
+				ReportDir: filepath.Join(reports, binary),
+				Env:       []string{test.IaCBinaryEnv + "=" + binary},
+			})
+			binaryRun.Version = version
+		}
+		ok = ok && binaryRun.OK()
+		result.Binaries = append(result.Binaries, binaryRun)
+	}
+	result.Differences = test.CompareSuiteResults(result.Binaries)
+
+	test.PrintSuiteResults(os.Stdout, "BINARY", result.Binaries, result.Differences)
+	return ok, test.WriteSuiteReport(reports, "toolchains", result)
+}
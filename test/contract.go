@@ -0,0 +1,366 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ModuleContract describes how the module's declared variables flow into the chart values
+type ModuleContract struct {
+	// Declared holds every variable declared in the module, keyed by name
+	Declared map[string]hcl.Range
+	// ValuesRefs holds the variables that reach the values merge or the other values documents of
+	// the helm release, directly or through locals
+	ValuesRefs map[string]bool
+	// SensitiveRefs holds the variables referenced from the `set_sensitive` list of the helm release,
+	// or from its `set_sensitive` blocks, including dynamic ones
+	SensitiveRefs map[string]bool
+	// AllRefs holds every `var.*` reference found in the module, keyed by name
+	AllRefs map[string][]hcl.Range
+	// DuplicateKeys lists values keys (dotted paths) that appear more than once in the same object
+	DuplicateKeys []string
+	// HelmV2Blocks lists helm release arguments written as blocks, plain or dynamic, that the helm
+	// provider 3.x only accepts as attributes
+	HelmV2Blocks []string
+	// ValuesKeys lists the top-level keys of the values documents the module passes to the merge,
+	// sorted. Overlays in var.values are merged onto them.
+	ValuesKeys []string
+}
+
+// helmV2BlockTypes are the helm_release blocks that became attributes in the helm provider 3.x
+var helmV2BlockTypes = map[string]bool{"set": true, "set_list": true, "set_sensitive": true, "postrender": true}
+
+// ParseModuleContract parses every .tf file in moduleDir and builds the ModuleContract
+func ParseModuleContract(moduleDir string) (*ModuleContract, error) {
+	paths, err := filepath.Glob(filepath.Join(moduleDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .tf files found in %s", moduleDir)
+	}
+	sort.Strings(paths)
+
+	contract := &ModuleContract{
+		Declared:      make(map[string]hcl.Range),
+		ValuesRefs:    make(map[string]bool),
+		SensitiveRefs: make(map[string]bool),
+		AllRefs:       make(map[string][]hcl.Range),
+	}
+
+	locals := make(map[string]hcl.Expression)
+	var mergeInput, releaseValues hcl.Expression
+
+	parser := hclparse.NewParser()
+	for _, path := range paths {
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		body := file.Body.(*hclsyntax.Body)
+		collectVarRefs(body, contract.AllRefs)
+
+		for _, block := range body.Blocks {
+			switch block.Type {
+			case "variable":
+				name := block.Labels[0]
+				if previous, exists := contract.Declared[name]; exists {
+					return nil, fmt.Errorf("variable %q declared twice (%s and %s)", name, previous, block.DefRange())
+				}
+				contract.Declared[name] = block.DefRange()
+			case "locals":
+				for name, attr := range block.Body.Attributes {
+					locals[name] = attr.Expr
+				}
+			case "data":
+				if block.Labels[0] == "utils_deep_merge_yaml" {
+					if attr, ok := block.Body.Attributes["input"]; ok {
+						mergeInput = attr.Expr
+					}
+				}
+			case "resource":
+				if block.Labels[0] != "helm_release" {
+					continue
+				}
+				if attr, ok := block.Body.Attributes["values"]; ok {
+					releaseValues = attr.Expr
+				}
+				// The helm provider 3.x takes set_sensitive as a list of objects
+				if attr, ok := block.Body.Attributes["set_sensitive"]; ok {
+					addVarRefs(attr.Expr, contract.SensitiveRefs)
+					contract.DuplicateKeys = append(contract.DuplicateKeys, duplicateSetNames(attr.Expr)...)
+				}
+				seen := make(map[string]bool)
+				for _, nested := range block.Body.Blocks {
+					blockType := nested.Type
+					if blockType == "dynamic" && len(nested.Labels) > 0 {
+						blockType = nested.Labels[0]
+					}
+					if helmV2BlockTypes[blockType] {
+						contract.HelmV2Blocks = append(contract.HelmV2Blocks, fmt.Sprintf("%s (%s)", blockType, nested.DefRange()))
+					}
+					// A dynamic "set_sensitive" block holds its attributes in a content block
+					if nested.Type == "dynamic" && len(nested.Labels) > 0 && nested.Labels[0] == "set_sensitive" {
+						for _, content := range nested.Body.Blocks {
+							if attr, ok := content.Body.Attributes["value"]; ok && content.Type == "content" {
+								addVarRefs(attr.Expr, contract.SensitiveRefs)
+							}
+						}
+						continue
+					}
+					if nested.Type != "set_sensitive" {
+						continue
+					}
+					if attr, ok := nested.Body.Attributes["value"]; ok {
+						addVarRefs(attr.Expr, contract.SensitiveRefs)
+					}
+					if attr, ok := nested.Body.Attributes["name"]; ok {
+						if name, ok := literalString(attr.Expr); ok {
+							if seen[name] {
+								contract.DuplicateKeys = append(contract.DuplicateKeys, name)
+							}
+							seen[name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if mergeInput == nil {
+		return nil, fmt.Errorf("no utils_deep_merge_yaml data source found in %s", moduleDir)
+	}
+	addVarRefs(mergeInput, contract.ValuesRefs)
+	pending := localRefs(mergeInput)
+	for _, name := range pending {
+		if expr, ok := locals[name]; ok {
+			contract.ValuesKeys = append(contract.ValuesKeys, objectKeys(expr)...)
+		}
+	}
+	sort.Strings(contract.ValuesKeys)
+	// Values documents passed to the release next to the merge output
+	if releaseValues != nil {
+		addVarRefs(releaseValues, contract.ValuesRefs)
+		pending = append(pending, localRefs(releaseValues)...)
+	}
+
+	// Follow the locals that feed the values, including locals referenced by other locals
+	visited := make(map[string]bool)
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		expr, ok := locals[name]
+		if visited[name] || !ok {
+			continue
+		}
+		visited[name] = true
+		addVarRefs(expr, contract.ValuesRefs)
+		contract.DuplicateKeys = append(contract.DuplicateKeys, findDuplicateKeys(expr, "")...)
+		pending = append(pending, localRefs(expr)...)
+	}
+
+	sort.Strings(contract.DuplicateKeys)
+	return contract, nil
+}
+
+// UnmappedVariables returns declared variables that neither reach the chart values nor are allowlisted
+func (c *ModuleContract) UnmappedVariables(allowlist []string) []string {
+	allowed := make(map[string]bool, len(allowlist))
+	for _, name := range allowlist {
+		allowed[name] = true
+	}
+
+	var unmapped []string
+	for name := range c.Declared {
+		if c.ValuesRefs[name] || c.SensitiveRefs[name] || allowed[name] {
+			continue
+		}
+		unmapped = append(unmapped, name)
+	}
+	sort.Strings(unmapped)
+	return unmapped
+}
+
+// UndeclaredReferences returns `var.*` references that have no matching variable declaration
+func (c *ModuleContract) UndeclaredReferences() []string {
+	var undeclared []string
+	for name, ranges := range c.AllRefs {
+		if _, ok := c.Declared[name]; ok {
+			continue
+		}
+		for _, rng := range ranges {
+			undeclared = append(undeclared, fmt.Sprintf("var.%s (%s)", name, rng))
+		}
+	}
+	sort.Strings(undeclared)
+	return undeclared
+}
+
+// collectVarRefs records every `var.*` traversal found anywhere in body
+func collectVarRefs(body *hclsyntax.Body, refs map[string][]hcl.Range) {
+	_ = hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			return nil
+		}
+		if name, ok := varName(expr.Traversal); ok {
+			refs[name] = append(refs[name], expr.SrcRange)
+		}
+		return nil
+	})
+}
+
+// addVarRefs records the names of every variable referenced by expr
+func addVarRefs(expr hcl.Expression, refs map[string]bool) {
+	for _, traversal := range expr.Variables() {
+		if name, ok := varName(traversal); ok {
+			refs[name] = true
+		}
+	}
+}
+
+// localRefs returns the names of every local value referenced by expr
+func localRefs(expr hcl.Expression) []string {
+	var names []string
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			names = append(names, attr.Name)
+		}
+	}
+	return names
+}
+
+func varName(traversal hcl.Traversal) (string, bool) {
+	if traversal.RootName() != "var" || len(traversal) < 2 {
+		return "", false
+	}
+	attr, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return "", false
+	}
+	return attr.Name, true
+}
+
+// findDuplicateKeys walks object constructors (including the ones passed to function calls
+// such as yamlencode) and returns the dotted paths of keys that are set more than once
+func findDuplicateKeys(expr hcl.Expression, prefix string) []string {
+	var duplicates []string
+
+	switch e := expr.(type) {
+	case *hclsyntax.FunctionCallExpr:
+		for _, arg := range e.Args {
+			duplicates = append(duplicates, findDuplicateKeys(arg, prefix)...)
+		}
+	case *hclsyntax.ParenthesesExpr:
+		duplicates = append(duplicates, findDuplicateKeys(e.Expression, prefix)...)
+	case *hclsyntax.ConditionalExpr:
+		duplicates = append(duplicates, findDuplicateKeys(e.TrueResult, prefix)...)
+		duplicates = append(duplicates, findDuplicateKeys(e.FalseResult, prefix)...)
+	case *hclsyntax.TupleConsExpr:
+		for _, item := range e.Exprs {
+			duplicates = append(duplicates, findDuplicateKeys(item, prefix)...)
+		}
+	case *hclsyntax.ObjectConsExpr:
+		seen := make(map[string]bool)
+		for _, item := range e.Items {
+			key, ok := objectKeyName(item.KeyExpr)
+			if !ok {
+				continue
+			}
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			if seen[key] {
+				duplicates = append(duplicates, path)
+			}
+			seen[key] = true
+			duplicates = append(duplicates, findDuplicateKeys(item.ValueExpr, path)...)
+		}
+	}
+
+	return duplicates
+}
+
+// duplicateSetNames returns the literal names set more than once in a list of set entries, such as
+// the helm provider 3.x `set_sensitive` attribute, looking through conditionals
+func duplicateSetNames(expr hcl.Expression) []string {
+	var duplicates []string
+
+	switch e := expr.(type) {
+	case *hclsyntax.ParenthesesExpr:
+		duplicates = append(duplicates, duplicateSetNames(e.Expression)...)
+	case *hclsyntax.ConditionalExpr:
+		duplicates = append(duplicates, duplicateSetNames(e.TrueResult)...)
+		duplicates = append(duplicates, duplicateSetNames(e.FalseResult)...)
+	case *hclsyntax.TupleConsExpr:
+		seen := make(map[string]bool)
+		for _, item := range e.Exprs {
+			object, ok := item.(*hclsyntax.ObjectConsExpr)
+			if !ok {
+				continue
+			}
+			for _, field := range object.Items {
+				if key, ok := objectKeyName(field.KeyExpr); !ok || key != "name" {
+					continue
+				}
+				if name, ok := literalString(field.ValueExpr); ok {
+					if seen[name] {
+						duplicates = append(duplicates, name)
+					}
+					seen[name] = true
+				}
+			}
+		}
+	}
+
+	return duplicates
+}
+
+// objectKeys returns the literal keys of the object constructor in expr, looking through function
+// calls such as yamlencode
+func objectKeys(expr hcl.Expression) []string {
+	switch e := expr.(type) {
+	case *hclsyntax.FunctionCallExpr:
+		var keys []string
+		for _, arg := range e.Args {
+			keys = append(keys, objectKeys(arg)...)
+		}
+		return keys
+	case *hclsyntax.ParenthesesExpr:
+		return objectKeys(e.Expression)
+	case *hclsyntax.ObjectConsExpr:
+		var keys []string
+		for _, item := range e.Items {
+			if key, ok := objectKeyName(item.KeyExpr); ok {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+	return nil
+}
+
+func objectKeyName(expr hcl.Expression) (string, bool) {
+	if keyword := hcl.ExprAsKeyword(expr); keyword != "" {
+		return keyword, true
+	}
+	return literalString(expr)
+}
+
+func literalString(expr hcl.Expression) (string, bool) {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
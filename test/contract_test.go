@@ -0,0 +1,73 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contractAllowlist holds variables that are consumed by the helm_release directly
+// rather than being mapped into the chart values
+var contractAllowlist = []string{
+	"helm_repository",
+	"chart",
+	"chart_version",
+	"create_namespace",
+}
+
+func TestModuleVariablesReachChartValues(t *testing.T) {
+	contract, err := ParseModuleContract("../")
+	require.NoError(t, err)
+	require.NotEmpty(t, contract.Declared, "Module should declare variables")
+
+	assert.Empty(t, contract.UnmappedVariables(contractAllowlist), "Every variable should reach the values merge or set_sensitive, or be allowlisted")
+	assert.Empty(t, contract.UndeclaredReferences(), "Every var.* reference should have a matching declaration")
+	assert.Empty(t, contract.DuplicateKeys, "Values keys should not be set more than once")
+	assert.Empty(t, contract.HelmV2Blocks, "The helm release should use the helm provider 3.x syntax")
+	assert.True(t, contract.SensitiveRefs["delegate_token"], "The delegate token should be passed through set_sensitive")
+
+	// An allowlisted variable that is no longer declared is a stale entry
+	for _, name := range contractAllowlist {
+		assert.Contains(t, contract.Declared, name, "Allowlisted variable %s should be declared", name)
+	}
+}
+
+func TestModuleContractDetectsViolations(t *testing.T) {
+	contract, err := ParseModuleContract("testdata/contract/broken")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"forgotten"}, contract.UnmappedVariables(nil))
+	assert.Len(t, contract.UndeclaredReferences(), 1)
+	assert.Contains(t, contract.UndeclaredReferences()[0], "var.proxy_host")
+	assert.Equal(t, []string{"accountId", "delegateToken", "upgrader.enabled"}, contract.DuplicateKeys)
+	require.Len(t, contract.HelmV2Blocks, 2)
+	assert.Contains(t, contract.HelmV2Blocks[0], "set_sensitive")
+}
+
+func TestModuleContractReadsSetSensitiveList(t *testing.T) {
+	moduleDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte(`resource "helm_release" "delegate" {
+  name   = "delegate"
+  chart  = "harness-delegate-ng"
+  values = [data.utils_deep_merge_yaml.values.output]
+
+  set_sensitive = var.token_from_secret ? [] : [
+    { name = "delegateToken", value = var.delegate_token },
+    { name = "delegateToken", value = var.delegate_token },
+  ]
+}
+
+data "utils_deep_merge_yaml" "values" {
+  input = [yamlencode({ accountId = "abc" })]
+}
+`), 0644))
+
+	contract, err := ParseModuleContract(moduleDir)
+	require.NoError(t, err)
+	assert.True(t, contract.SensitiveRefs["delegate_token"])
+	assert.Equal(t, []string{"delegateToken"}, contract.DuplicateKeys)
+	assert.Empty(t, contract.HelmV2Blocks)
+}
@@ -0,0 +1,450 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultFatalReasons are event and container waiting reasons no amount of waiting recovers from
+var DefaultFatalReasons = []string{
+	"ErrImagePull",
+	"ImagePullBackOff",
+	"InvalidImageName",
+	"FailedMount",
+	"FailedAttachVolume",
+	// Typically a missing Secret or ConfigMap, such as the mTLS secret
+	"CreateContainerConfigError",
+	"CreateContainerError",
+	"CrashLoopBackOff",
+	// Typically a ReplicaSet rejected by a quota or an admission policy
+	"FailedCreate",
+}
+
+// TimelineEntry is an event or a pod status change seen while watching a namespace
+type TimelineEntry struct {
+	// Offset is the time since the watch started
+	Offset  time.Duration
+	Type    string
+	Object  string
+	Reason  string
+	Message string
+	Fatal   bool
+}
+
+// String returns the entry as a single timeline line
+func (e TimelineEntry) String() string {
+	line := fmt.Sprintf("+%5.1fs %-7s %s %s", e.Offset.Seconds(), e.Type, e.Object, e.Reason)
+	if e.Message != "" {
+		line += ": " + e.Message
+	}
+	return line
+}
+
+// SummarizeTimeline renders the entries one per line, folding consecutive repeats into a count
+func SummarizeTimeline(entries []TimelineEntry) string {
+	var lines []string
+	for i := 0; i < len(entries); {
+		j := i + 1
+		for j < len(entries) && entries[j].Object == entries[i].Object && entries[j].Reason == entries[i].Reason && entries[j].Message == entries[i].Message {
+			j++
+		}
+		line := entries[i].String()
+		if j-i > 1 {
+			line += fmt.Sprintf(" (x%d)", j-i)
+		}
+		lines = append(lines, line)
+		i = j
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FatalEventError is returned when a fatal event or pod status was seen
+type FatalEventError struct {
+	Entry    TimelineEntry
+	Timeline []TimelineEntry
+}
+
+func (e *FatalEventError) Error() string {
+	return fmt.Sprintf("fatal %s on %s after %s: %s\ntimeline:\n%s",
+		e.Entry.Reason, e.Entry.Object, e.Entry.Offset.Round(100*time.Millisecond), e.Entry.Message, SummarizeTimeline(e.Timeline))
+}
+
+// EventWatcher streams the events and pod statuses of a namespace into a timeline, and signals
+// the first fatal one
+type EventWatcher struct {
+	fatalReasons map[string]bool
+	start        time.Time
+
+	mu       sync.Mutex
+	timeline []TimelineEntry
+	// podReasons holds the last reason recorded per container, to record changes only
+	podReasons map[string]string
+
+	fatal     chan TimelineEntry
+	fatalOnce sync.Once
+	cancel    context.CancelFunc
+	done      sync.WaitGroup
+}
+
+// NewEventWatcher starts watching the namespace. The watches are established before it returns,
+// so nothing that happens afterwards is missed.
+func NewEventWatcher(client kubernetes.Interface, namespace string, fatalReasons []string) (*EventWatcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &EventWatcher{
+		fatalReasons: make(map[string]bool, len(fatalReasons)),
+		start:        time.Now(),
+		podReasons:   make(map[string]string),
+		fatal:        make(chan TimelineEntry, 1),
+		cancel:       cancel,
+	}
+	for _, reason := range fatalReasons {
+		w.fatalReasons[reason] = true
+	}
+
+	watchers := map[string]func() (watch.Interface, error){
+		"events": func() (watch.Interface, error) {
+			return client.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{})
+		},
+		"pods": func() (watch.Interface, error) {
+			return client.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{})
+		},
+	}
+	for name, start := range watchers {
+		watcher, err := start()
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("watching %s in namespace %s: %w", name, namespace, err)
+		}
+		w.done.Add(1)
+		go w.consume(ctx, watcher, start)
+	}
+	return w, nil
+}
+
+// StartEventWatcher starts an EventWatcher on the namespace of kubectlOptions, stopped when the
+// test completes
+func StartEventWatcher(t *testing.T, kubectlOptions *k8s.KubectlOptions, fatalReasons []string) *EventWatcher {
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+	watcher, err := NewEventWatcher(client, kubectlOptions.Namespace, fatalReasons)
+	require.NoError(t, err)
+	t.Cleanup(func() { watcher.Stop() })
+	return watcher
+}
+
+// consume handles the watch events, re-establishing the watch when the server closes it
+func (w *EventWatcher) consume(ctx context.Context, watcher watch.Interface, restart func() (watch.Interface, error)) {
+	defer w.done.Done()
+	for {
+		w.drain(ctx, watcher)
+		if ctx.Err() != nil {
+			return
+		}
+
+		var err error
+		for watcher, err = restart(); err != nil; watcher, err = restart() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// drain handles the watch events until the watch closes or the context is done
+func (w *EventWatcher) drain(ctx context.Context, watcher watch.Interface) {
+	defer watcher.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			switch object := event.Object.(type) {
+			case *corev1.Event:
+				w.recordEvent(object)
+			case *corev1.Pod:
+				w.recordPod(object)
+			}
+		}
+	}
+}
+
+// eventTime returns the last time the event occurred
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// isFatalEvent matches the event reason, or the "Error: <reason>" messages of the kubelet
+func (w *EventWatcher) isFatalEvent(event *corev1.Event) bool {
+	if event.Type != corev1.EventTypeWarning {
+		return false
+	}
+	if w.fatalReasons[event.Reason] {
+		return true
+	}
+	for reason := range w.fatalReasons {
+		if strings.HasPrefix(event.Message, "Error: "+reason) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *EventWatcher) recordEvent(event *corev1.Event) {
+	// The watch replays the events already in the namespace; those predate this watcher
+	at := eventTime(event)
+	if at.Before(w.start.Truncate(time.Second)) {
+		return
+	}
+	w.record(TimelineEntry{
+		Offset:  at.Sub(w.start),
+		Type:    event.Type,
+		Object:  fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name),
+		Reason:  event.Reason,
+		Message: strings.TrimSpace(event.Message),
+		Fatal:   w.isFatalEvent(event),
+	})
+}
+
+func (w *EventWatcher) recordPod(pod *corev1.Pod) {
+	if pod.CreationTimestamp.Time.Before(w.start.Truncate(time.Second)) {
+		return
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		reason, message := "", ""
+		switch {
+		case status.State.Waiting != nil:
+			reason, message = status.State.Waiting.Reason, status.State.Waiting.Message
+		case status.State.Running != nil && status.Ready:
+			reason = "Ready"
+		case status.State.Terminated != nil:
+			reason, message = status.State.Terminated.Reason, status.State.Terminated.Message
+		}
+
+		key := fmt.Sprintf("%s/%s", pod.Name, status.Name)
+		w.mu.Lock()
+		changed := reason != "" && w.podReasons[key] != reason
+		w.podReasons[key] = reason
+		w.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		entryType := corev1.EventTypeNormal
+		fatal := status.State.Waiting != nil && w.fatalReasons[reason]
+		if fatal {
+			entryType = corev1.EventTypeWarning
+		}
+		w.record(TimelineEntry{
+			Offset:  time.Since(w.start),
+			Type:    entryType,
+			Object:  fmt.Sprintf("Pod/%s[%s]", pod.Name, status.Name),
+			Reason:  reason,
+			Message: strings.TrimSpace(message),
+			Fatal:   fatal,
+		})
+	}
+}
+
+func (w *EventWatcher) record(entry TimelineEntry) {
+	w.mu.Lock()
+	w.timeline = append(w.timeline, entry)
+	w.mu.Unlock()
+
+	if entry.Fatal {
+		w.fatalOnce.Do(func() { w.fatal <- entry })
+	}
+}
+
+// Fatal receives the first fatal entry
+func (w *EventWatcher) Fatal() <-chan TimelineEntry {
+	return w.fatal
+}
+
+// Timeline returns the entries recorded so far
+func (w *EventWatcher) Timeline() []TimelineEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]TimelineEntry(nil), w.timeline...)
+}
+
+// Stop ends the watches and returns the timeline
+func (w *EventWatcher) Stop() []TimelineEntry {
+	w.cancel()
+	w.done.Wait()
+	return w.Timeline()
+}
+
+// fatalError wraps a fatal entry with the timeline
+func (w *EventWatcher) fatalError(entry TimelineEntry) error {
+	return &FatalEventError{Entry: entry, Timeline: w.Timeline()}
+}
+
+// applyInterruptGrace is how long an interrupted apply may take to stop gracefully
+const applyInterruptGrace = 30 * time.Second
+
+// InitAndApplyWatchingEventsE runs terraform init and apply, interrupting the apply as soon as
+// the watcher sees a fatal event rather than letting the helm provider wait for its timeout.
+// The apply runs in its own process so that it can be interrupted; Terraform then stops
+// gracefully and saves its state, so a deferred destroy still works. As with terraform.ApplyE,
+// the options' arguments are used and retryable errors are retried; an interrupted apply is not.
+func InitAndApplyWatchingEventsE(t *testing.T, terraformOptions *terraform.Options, watcher *EventWatcher) error {
+	if _, err := terraform.InitE(t, terraformOptions); err != nil {
+		return err
+	}
+
+	options, args := terraform.GetCommonOptions(terraformOptions, terraform.FormatArgs(terraformOptions, "apply", "-input=false", "-auto-approve")...)
+	description := fmt.Sprintf("%s %v", options.TerraformBinary, args)
+
+	var fatalErr error
+	_, err := retry.DoWithRetryableErrorsE(t, description, options.RetryableTerraformErrors, options.MaxRetries, options.TimeBetweenRetries, func() (string, error) {
+		output, err := applyWatchingEvents(t, options, args, watcher)
+		if fatalErr = asFatalEventError(err); fatalErr != nil {
+			// Ends the retries
+			return output, nil
+		}
+		return output, err
+	})
+	if fatalErr != nil {
+		return fatalErr
+	}
+	if err != nil {
+		return fmt.Errorf("terraform apply: %w\ntimeline:\n%s", err, SummarizeTimeline(watcher.Timeline()))
+	}
+	return nil
+}
+
+// asFatalEventError returns err if it is a *FatalEventError, nil otherwise
+func asFatalEventError(err error) error {
+	var fatal *FatalEventError
+	if errors.As(err, &fatal) {
+		return err
+	}
+	return nil
+}
+
+// applyWatchingEvents runs one apply process with the formatted args, interrupting it on the first
+// fatal event, and returns its output
+func applyWatchingEvents(t *testing.T, options *terraform.Options, args []string, watcher *EventWatcher) (string, error) {
+	log := options.Logger
+	log.Logf(t, "Running command %s with args %s", options.TerraformBinary, args)
+
+	cmd := exec.Command(options.TerraformBinary, args...)
+	cmd.Dir = options.TerraformDir
+	cmd.Env = os.Environ()
+	for key, value := range options.EnvVars {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var captured strings.Builder
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		logLines(t, log, output, &captured)
+	}()
+	applied := make(chan error, 1)
+	go func() {
+		<-logged
+		applied <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-applied:
+		return captured.String(), err
+	case entry := <-watcher.Fatal():
+		log.Logf(t, "Interrupting terraform apply: %s", entry)
+		_ = cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-applied:
+		case <-time.After(applyInterruptGrace):
+			// A second interrupt makes Terraform exit without waiting for the provider
+			_ = cmd.Process.Signal(os.Interrupt)
+			<-applied
+		}
+		return captured.String(), watcher.fatalError(entry)
+	}
+}
+
+// InitAndApplyWatchingEvents is InitAndApplyWatchingEventsE, failing the test on error
+func InitAndApplyWatchingEvents(t *testing.T, terraformOptions *terraform.Options, watcher *EventWatcher) {
+	require.NoError(t, InitAndApplyWatchingEventsE(t, terraformOptions, watcher))
+}
+
+// logLines logs the output line by line, through the given logger, and copies it to captured
+func logLines(t *testing.T, log *logger.Logger, output io.Reader, captured *strings.Builder) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		log.Logf(t, "%s", scanner.Text())
+		captured.WriteString(scanner.Text())
+		captured.WriteString("\n")
+	}
+}
+
+// WaitUntilDeploymentAvailableWatchingEventsE waits for the deployment to be available, returning
+// as soon as the watcher sees a fatal event
+func WaitUntilDeploymentAvailableWatchingEventsE(t *testing.T, kubectlOptions *k8s.KubectlOptions, watcher *EventWatcher, deploymentName string, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		deployment, err := k8s.GetDeploymentE(t, kubectlOptions, deploymentName)
+		if err == nil && deploymentAvailable(deployment) {
+			return nil
+		}
+
+		select {
+		case entry := <-watcher.Fatal():
+			return watcher.fatalError(entry)
+		case <-deadline:
+			return fmt.Errorf("deployment %s not available after %s\ntimeline:\n%s", deploymentName, timeout, SummarizeTimeline(watcher.Timeline()))
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitUntilDeploymentAvailableWatchingEvents is WaitUntilDeploymentAvailableWatchingEventsE,
+// failing the test on error and logging the timeline otherwise
+func WaitUntilDeploymentAvailableWatchingEvents(t *testing.T, kubectlOptions *k8s.KubectlOptions, watcher *EventWatcher, deploymentName string, timeout time.Duration) {
+	require.NoError(t, WaitUntilDeploymentAvailableWatchingEventsE(t, kubectlOptions, watcher, deploymentName, timeout))
+	logger.Default.Logf(t, "Deployment %s available, timeline:\n%s", deploymentName, SummarizeTimeline(watcher.Timeline()))
+}
@@ -0,0 +1,210 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSummarizeTimeline(t *testing.T) {
+	entries := []TimelineEntry{
+		{Offset: 1200 * time.Millisecond, Type: "Normal", Object: "Pod/delegate-0", Reason: "Scheduled", Message: "assigned to node-1"},
+		{Offset: 3 * time.Second, Type: "Warning", Object: "Pod/delegate-0", Reason: "BackOff", Message: "Back-off pulling image"},
+		{Offset: 9 * time.Second, Type: "Warning", Object: "Pod/delegate-0", Reason: "BackOff", Message: "Back-off pulling image"},
+		{Offset: 10 * time.Second, Type: "Normal", Object: "Pod/delegate-0[delegate]", Reason: "Ready"},
+	}
+
+	assert.Equal(t, strings.Join([]string{
+		"+  1.2s Normal  Pod/delegate-0 Scheduled: assigned to node-1",
+		"+  3.0s Warning Pod/delegate-0 BackOff: Back-off pulling image (x2)",
+		"+ 10.0s Normal  Pod/delegate-0[delegate] Ready",
+	}, "\n"), SummarizeTimeline(entries))
+}
+
+func TestEventWatcherFailsFast(t *testing.T) {
+	ctx := context.Background()
+	namespace := "harness-delegate-ng"
+	stale := metav1.NewTime(time.Now().Add(-time.Hour))
+	client := fake.NewSimpleClientset(
+		// Events from before the watch are ignored, even fatal ones
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "stale", Namespace: namespace},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "old"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "FailedMount",
+			LastTimestamp:  stale,
+		},
+	)
+
+	watcher, err := NewEventWatcher(client, namespace, DefaultFatalReasons)
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	now := metav1.Now()
+	_, err = client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "scheduled", Namespace: namespace},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "delegate-0"},
+		Type:           corev1.EventTypeNormal,
+		Reason:         "Scheduled",
+		LastTimestamp:  now,
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// A kubelet "Failed" event only names the reason in its message
+	_, err = client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "failed", Namespace: namespace},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "delegate-0"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "Failed",
+		Message:        "Error: ErrImagePull",
+		LastTimestamp:  now,
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	select {
+	case entry := <-watcher.Fatal():
+		assert.Equal(t, "Pod/delegate-0", entry.Object)
+		assert.Equal(t, "Failed", entry.Reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The fatal event should be signalled")
+	}
+
+	timeline := watcher.Stop()
+	require.Len(t, timeline, 2)
+	assert.Equal(t, "Scheduled", timeline[0].Reason)
+	assert.False(t, timeline[0].Fatal)
+	assert.True(t, timeline[1].Fatal)
+
+	var fatalErr *FatalEventError
+	require.True(t, errors.As(watcher.fatalError(timeline[1]), &fatalErr))
+	assert.Contains(t, fatalErr.Error(), "Scheduled")
+}
+
+func TestInitAndApplyWatchingEventsRetries(t *testing.T) {
+	// A fake binary whose first apply fails with a retryable error, recording its arguments
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "fake-terraform")
+	script := `#!/bin/sh
+[ "$1" = "init" ] && exit 0
+echo "$@" >> "` + dir + `/applies"
+if [ ! -f "` + dir + `/failed" ]; then
+  touch "` + dir + `/failed"
+  echo "Error: flaky registry"
+  exit 1
+fi
+echo "Apply complete!"
+`
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0755))
+
+	watcher, err := NewEventWatcher(fake.NewSimpleClientset(), "harness-delegate-ng", DefaultFatalReasons)
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	options := &terraform.Options{
+		TerraformBinary:          binary,
+		TerraformDir:             dir,
+		Parallelism:              3,
+		RetryableTerraformErrors: map[string]string{"flaky registry": "The registry is flaky"},
+		MaxRetries:               2,
+	}
+	require.NoError(t, InitAndApplyWatchingEventsE(t, options, watcher))
+
+	applies, err := os.ReadFile(filepath.Join(dir, "applies"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(applies)), "\n")
+	require.Len(t, lines, 2, "The retryable failure should be retried once")
+	assert.Contains(t, lines[1], "--parallelism=3", "The options' arguments should be passed")
+
+	// Without the error marked retryable, the first failure is final
+	require.NoError(t, os.Remove(filepath.Join(dir, "failed")))
+	options.RetryableTerraformErrors = nil
+	assert.Error(t, InitAndApplyWatchingEventsE(t, options, watcher))
+}
+
+func TestEventWatcherPodStatus(t *testing.T) {
+	ctx := context.Background()
+	namespace := "harness-delegate-ng"
+	client := fake.NewSimpleClientset()
+
+	// CreateContainerConfigError does not show in the event reason, only in the pod status
+	watcher, err := NewEventWatcher(client, namespace, []string{"CreateContainerConfigError"})
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "delegate-0", Namespace: namespace, CreationTimestamp: metav1.Now()},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "delegate",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+		}}},
+	}
+	_, err = client.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	pod.Status.ContainerStatuses[0].State.Waiting = &corev1.ContainerStateWaiting{
+		Reason:  "CreateContainerConfigError",
+		Message: `secret "delegate-mtls" not found`,
+	}
+	_, err = client.CoreV1().Pods(namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	select {
+	case entry := <-watcher.Fatal():
+		assert.Equal(t, "Pod/delegate-0[delegate]", entry.Object)
+		assert.Equal(t, "CreateContainerConfigError", entry.Reason)
+		assert.Contains(t, entry.Message, "delegate-mtls")
+	case <-time.After(5 * time.Second):
+		t.Fatal("The fatal pod status should be signalled")
+	}
+
+	timeline := watcher.Stop()
+	require.Len(t, timeline, 2)
+	assert.Equal(t, "ContainerCreating", timeline[0].Reason)
+}
+
+func TestDelegateWithMissingImageFailsFast(t *testing.T) {
+	t.Parallel()
+
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	testNamespace := AllocateNamespace(t, "harness-delegate-events")
+
+	vars := DefaultTerraformVars(testNamespace.Name, delegateName)
+	vars["create_namespace"] = false
+	vars["delegate_image"] = "harness/delegate:does-not-exist"
+	terraformOptions := &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	}
+	MoveSecretVarsToEnv(t, terraformOptions)
+
+	// Point the helm provider at the helpers' cluster
+	DefaultClusterTarget().ConfigureTerraform(t, terraformOptions, testNamespace.KubectlOptions)
+
+	// Clean up resources after test
+	defer terraform.Destroy(t, terraformOptions)
+
+	// The apply must stop on the image pull failure, well before the helm provider's 5 minute wait
+	watcher := StartEventWatcher(t, testNamespace.KubectlOptions, DefaultFatalReasons)
+	started := time.Now()
+	err := InitAndApplyWatchingEventsE(t, terraformOptions, watcher)
+	elapsed := time.Since(started)
+
+	var fatalErr *FatalEventError
+	require.True(t, errors.As(err, &fatalErr), "Apply should fail on a fatal event, got: %v", err)
+	assert.Contains(t, fatalErr.Error(), "does-not-exist")
+	assert.Less(t, elapsed, 3*time.Minute, "Apply should be interrupted early")
+	t.Logf("Failed after %s:\n%s", elapsed.Round(time.Second), fatalErr)
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+// GoldenDir holds the golden files of the rendered scenarios, one directory per scenario
+const GoldenDir = "testdata/golden"
+
+// GoldenMasked replaces Secret data in golden files
+const GoldenMasked = "[MASKED]"
+
+// goldenVolatileLabels change with every chart release without changing what is deployed
+var goldenVolatileLabels = map[string]string{
+	"helm.sh/chart":             "[CHART]",
+	"app.kubernetes.io/version": "[APP_VERSION]",
+}
+
+// redactSecrets replaces the secrets, verbatim or base64 encoded, with RedactedPlaceholder
+func redactSecrets(content string, secrets []string) string {
+	redactor := NewRedactingLogger(nil)
+	redactor.RegisterSecret(secrets...)
+	return redactor.Redact(content)
+}
+
+// maskStrings redacts the secrets in every string of the object, and replaces the values of
+// goldenVolatileLabels. Masking before marshalling keeps the placeholders quoted.
+func maskStrings(node interface{}, secrets []string) interface{} {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if placeholder, ok := goldenVolatileLabels[key]; ok {
+				value[key] = placeholder
+				continue
+			}
+			value[key] = maskStrings(child, secrets)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = maskStrings(child, secrets)
+		}
+	case string:
+		return redactSecrets(value, secrets)
+	}
+	return node
+}
+
+// NormalizeValues returns a values document with sorted keys and the secrets masked
+func NormalizeValues(values string, secrets []string) (string, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(values), &doc); err != nil {
+		return "", err
+	}
+	normalized, err := yaml.Marshal(maskStrings(doc, secrets))
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// NormalizeManifest returns a manifest with its objects sorted by kind, namespace and name, keys
+// sorted, Secret data masked along with the secrets, and chart version labels replaced
+func NormalizeManifest(manifest string, secrets []string) (string, error) {
+	objects, err := ParseManifest(manifest)
+	if err != nil {
+		return "", err
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Metadata.Namespace != b.Metadata.Namespace {
+			return a.Metadata.Namespace < b.Metadata.Namespace
+		}
+		return a.Metadata.Name < b.Metadata.Name
+	})
+
+	docs := make([]string, 0, len(objects))
+	for _, object := range objects {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(object.Raw, &doc); err != nil {
+			return "", fmt.Errorf("%s: %w", object, err)
+		}
+		maskStrings(doc, secrets)
+		if object.Kind == "Secret" {
+			for _, field := range []string{"data", "stringData"} {
+				if data, ok := doc[field].(map[string]interface{}); ok {
+					for key := range data {
+						data[key] = GoldenMasked
+					}
+				}
+			}
+		}
+		content, err := yaml.Marshal(doc)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", object, err)
+		}
+		docs = append(docs, string(content))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
+
+// CheckGolden compares actual with the golden file at path and returns the golden content. With
+// update, the file is written with actual instead.
+func CheckGolden(path, actual string, update bool) (string, error) {
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		return actual, os.WriteFile(path, []byte(actual), 0644)
+	}
+	expected, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("golden file %s does not exist, run the test with -update to create it", path)
+	}
+	return string(expected), err
+}
+
+// AssertGolden asserts that actual matches the golden file <GoldenDir>/<name>, or rewrites the
+// file with update. Mismatches are reported as a diff.
+func AssertGolden(t *testing.T, name, actual string, update bool) {
+	path := filepath.Join(GoldenDir, name)
+	expected, err := CheckGolden(path, actual, update)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual, "%s differs from the rendered output; review the diff and run the test with -update if the change is intended", path)
+}
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"encoding/base64"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden with the rendered output")
+
+func TestNormalizeValues(t *testing.T) {
+	normalized, err := NormalizeValues("proxyPassword: hunter2\naccountId: abc\nupgrader:\n  enabled: true\n", []string{"hunter2"})
+	require.NoError(t, err)
+	assert.Equal(t, "accountId: abc\nproxyPassword: '[REDACTED]'\nupgrader:\n  enabled: true\n", normalized)
+
+	_, err = NormalizeValues("key: [unterminated", nil)
+	assert.Error(t, err)
+}
+
+func TestNormalizeManifest(t *testing.T) {
+	manifest := `# Source: harness-delegate-ng/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: golden-delegate
+  labels:
+    helm.sh/chart: harness-delegate-ng-1.0.22
+    app.kubernetes.io/version: "1.16.0"
+spec:
+  template:
+    metadata:
+      labels:
+        helm.sh/chart: harness-delegate-ng-1.0.22
+    spec:
+      containers:
+      - name: delegate
+        env:
+        - name: PROXY_PASSWORD
+          value: hunter2
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: golden-delegate
+data:
+  DELEGATE_TOKEN: ` + base64.StdEncoding.EncodeToString([]byte("token")) + `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: golden-delegate
+data:
+  PROXY_AUTH: ` + base64.StdEncoding.EncodeToString([]byte("hunter2")) + `
+`
+
+	normalized, err := NormalizeManifest(manifest, []string{"hunter2"})
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: v1
+data:
+  PROXY_AUTH: '[REDACTED]'
+kind: ConfigMap
+metadata:
+  name: golden-delegate
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app.kubernetes.io/version: '[APP_VERSION]'
+    helm.sh/chart: '[CHART]'
+  name: golden-delegate
+spec:
+  template:
+    metadata:
+      labels:
+        helm.sh/chart: '[CHART]'
+    spec:
+      containers:
+      - env:
+        - name: PROXY_PASSWORD
+          value: '[REDACTED]'
+        name: delegate
+---
+apiVersion: v1
+data:
+  DELEGATE_TOKEN: '[MASKED]'
+kind: Secret
+metadata:
+  name: golden-delegate
+`, normalized)
+
+	// Document order does not matter
+	reordered, err := NormalizeManifest("kind: Secret\nmetadata:\n  name: b\n---\nkind: Secret\nmetadata:\n  name: a\n", nil)
+	require.NoError(t, err)
+	again, err := NormalizeManifest("kind: Secret\nmetadata:\n  name: a\n---\nkind: Secret\nmetadata:\n  name: b\n", nil)
+	require.NoError(t, err)
+	assert.Equal(t, again, reordered)
+}
+
+func TestCheckGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario", "values.yaml")
+
+	_, err := CheckGolden(path, "a: 1\n", false)
+	assert.ErrorContains(t, err, "-update")
+
+	_, err = CheckGolden(path, "a: 1\n", true)
+	require.NoError(t, err)
+	expected, err := CheckGolden(path, "a: 2\n", false)
+	require.NoError(t, err)
+	assert.Equal(t, "a: 1\n", expected)
+}
+
+// goldenChartVersion is the chart version the golden files are rendered with, so that a new chart
+// release does not change them. GOLDEN_CHART_VERSION overrides it when moving to a new release.
+const goldenChartVersion = "1.0.22"
+
+// goldenScenarios are the rendered scenarios kept under testdata/golden, by directory name
+var goldenScenarios = map[string]map[string]interface{}{
+	"default": {},
+	"proxy": {
+		"proxy_host":     "proxy.example.com",
+		"proxy_port":     "3128",
+		"proxy_scheme":   "http",
+		"proxy_user":     "proxy-user",
+		"proxy_password": "golden-proxy-password",
+		"no_proxy":       ".cluster.local",
+	},
+	"upgrader": {
+		"upgrader_enabled":   true,
+		"image_pull_secrets": []string{"registry-credentials"},
+	},
+	"existing-token-secret": {
+		"delegate_token":                      "",
+		"existing_delegate_token_secret_name": "delegate-token",
+	},
+	"ca-bundle": {
+		"ca_bundle_secret_name": "corporate-ca",
+	},
+	"scheduling": {
+		"node_selector": map[string]string{"kubernetes.io/os": "linux"},
+		"tolerations":   []map[string]interface{}{{"key": "dedicated", "value": "tooling", "effect": "NoSchedule"}},
+	},
+	"autoscaling": {
+		"autoscaling":           map[string]interface{}{"min_replicas": 2, "max_replicas": 4},
+		"pod_disruption_budget": map[string]interface{}{"min_available": 1},
+	},
+	"resources-overlay": {
+		"values": "@resources-consistent.yaml",
+	},
+}
+
+func TestRenderedGoldenFiles(t *testing.T) {
+	for name, overrides := range goldenScenarios {
+		name, overrides := name, overrides
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// A fixed release name and chart version keep the output stable
+			vars := DefaultTerraformVars("harness-delegate-ng", "golden-delegate")
+			vars["delegate_image"] = "harness/delegate:golden"
+			vars["chart_version"] = goldenChartVersion
+			if version := os.Getenv("GOLDEN_CHART_VERSION"); version != "" {
+				vars["chart_version"] = version
+			}
+			for key, value := range overrides {
+				if overlay, ok := value.(string); ok && len(overlay) > 1 && overlay[0] == '@' {
+					value = LoadValuesOverlay(t, overlay[1:])
+				}
+				vars[key] = value
+			}
+			// Each scenario renders in its own copy of the module, as they run in parallel
+			terraformOptions := &terraform.Options{TerraformDir: CopyModuleDir(t), Vars: vars}
+
+			var secrets []string
+			for _, secretVar := range SecretVarNames {
+				secrets = append(secrets, stringVar(vars, secretVar, ""))
+			}
+
+			values := RenderDelegateValues(t, terraformOptions)
+			normalizedValues, err := NormalizeValues(values, secrets)
+			require.NoError(t, err)
+			AssertGolden(t, filepath.Join(name, "values.yaml"), normalizedValues, *update)
+
+			manifest, err := NormalizeManifest(RenderDelegateManifestFromValues(t, terraformOptions, values), secrets)
+			require.NoError(t, err)
+			AssertGolden(t, filepath.Join(name, "manifest.yaml"), manifest, *update)
+		})
+	}
+}
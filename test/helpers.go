@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 
@@ -29,6 +30,13 @@ func DefaultTerraformVars(namespaceName, delegateName string) map[string]interfa
 	}
 }
 
+// LoadValuesOverlay reads a values overlay from testdata/overlays to pass as the `values` variable
+func LoadValuesOverlay(t *testing.T, name string) string {
+	content, err := os.ReadFile(fmt.Sprintf("testdata/overlays/%s", name))
+	require.NoError(t, err, "Overlay %s should exist", name)
+	return string(content)
+}
+
 // HelmRelease models a release from `helm list -o json`
 type HelmRelease struct {
 	Name      string `json:"name"`
@@ -36,6 +44,8 @@ type HelmRelease struct {
 	Status    string `json:"status"`
 	Chart     string `json:"chart"`
 	AppVer    string `json:"app_version"`
+	// Revision counts the installs and upgrades of the release
+	Revision string `json:"revision"`
 }
 
 // ProxyConfig represents proxy configuration for testing
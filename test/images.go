@@ -0,0 +1,192 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const defaultRegistry = "docker.io"
+
+var (
+	digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	tagPattern    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+	// DelegateVersionPattern matches delegate tags such as 24.07.83404 or 24.07.83404.minimal
+	DelegateVersionPattern = regexp.MustCompile(`^\d{2}\.\d{2}\.\d+(\.[a-z0-9-]+)?$`)
+)
+
+// ImageReference is a parsed container image reference
+type ImageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// String returns the fully qualified reference
+func (r ImageReference) String() string {
+	ref := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		ref += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		ref += "@" + r.Digest
+	}
+	return ref
+}
+
+// ParseImageReference parses an image reference the way the container runtime does, defaulting
+// the registry to docker.io and single-name repositories to library/
+func ParseImageReference(ref string) (ImageReference, error) {
+	var image ImageReference
+	if ref == "" {
+		return image, fmt.Errorf("empty image reference")
+	}
+
+	remainder := ref
+	if i := strings.Index(remainder, "@"); i >= 0 {
+		image.Digest = remainder[i+1:]
+		remainder = remainder[:i]
+		if !digestPattern.MatchString(image.Digest) {
+			return image, fmt.Errorf("invalid digest %q in %q", image.Digest, ref)
+		}
+	}
+
+	// The tag is after the last colon of the last path component, so registry ports are not mistaken for tags
+	if i := strings.LastIndex(remainder, ":"); i > strings.LastIndex(remainder, "/") {
+		image.Tag = remainder[i+1:]
+		remainder = remainder[:i]
+		if !tagPattern.MatchString(image.Tag) {
+			return image, fmt.Errorf("invalid tag %q in %q", image.Tag, ref)
+		}
+	}
+
+	parts := strings.SplitN(remainder, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		image.Registry = parts[0]
+		image.Repository = parts[1]
+	} else {
+		image.Registry = defaultRegistry
+		image.Repository = remainder
+	}
+	if image.Registry == defaultRegistry && !strings.Contains(image.Repository, "/") {
+		image.Repository = "library/" + image.Repository
+	}
+	if image.Repository == "" || image.Repository != strings.ToLower(image.Repository) {
+		return image, fmt.Errorf("invalid repository in %q", ref)
+	}
+
+	return image, nil
+}
+
+// ImagePolicy describes which images are acceptable
+type ImagePolicy struct {
+	// AllowedRegistries are registry hosts, optionally with a repository prefix
+	// (e.g. registry.example.com/harness). Empty allows any registry.
+	AllowedRegistries []string
+	// RequireDigest requires every image to be pinned by digest
+	RequireDigest bool
+	// ForbidLatest rejects images without a digest that have no tag or the latest tag
+	ForbidLatest bool
+	// TagPattern, when set, must match the tag
+	TagPattern *regexp.Regexp
+}
+
+// ImageViolation is a single image policy violation
+type ImageViolation struct {
+	Workload  string
+	Container string
+	Image     string
+	Reason    string
+}
+
+func (v ImageViolation) String() string {
+	return fmt.Sprintf("%s container %s image %q: %s", v.Workload, v.Container, v.Image, v.Reason)
+}
+
+// CheckImage returns the reasons an image reference violates the policy
+func CheckImage(ref string, policy ImagePolicy) []string {
+	image, err := ParseImageReference(ref)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var reasons []string
+	if len(policy.AllowedRegistries) > 0 && !registryAllowed(image, policy.AllowedRegistries) {
+		reasons = append(reasons, fmt.Sprintf("registry %s is not in %v", image.Registry, policy.AllowedRegistries))
+	}
+	if policy.RequireDigest && image.Digest == "" {
+		reasons = append(reasons, "image is not pinned by digest")
+	}
+	if policy.ForbidLatest && image.Digest == "" && (image.Tag == "" || image.Tag == "latest") {
+		reasons = append(reasons, "image has no tag or uses the latest tag")
+	}
+	if policy.TagPattern != nil && image.Tag != "" && !policy.TagPattern.MatchString(image.Tag) {
+		reasons = append(reasons, fmt.Sprintf("tag %s does not match %s", image.Tag, policy.TagPattern))
+	}
+	return reasons
+}
+
+// CheckImagePolicy checks every container image of a workload, including init containers
+func CheckImagePolicy(workload WorkloadPodSpec, policy ImagePolicy) []ImageViolation {
+	var violations []ImageViolation
+
+	spec := workload.Template.Spec
+	for _, container := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+		for _, reason := range CheckImage(container.Image, policy) {
+			violations = append(violations, ImageViolation{
+				Workload:  workload.String(),
+				Container: container.Name,
+				Image:     container.Image,
+				Reason:    reason,
+			})
+		}
+	}
+
+	return violations
+}
+
+// ValidateImagePolicy fails the test if any workload image violates the policy
+func ValidateImagePolicy(t *testing.T, workloads []WorkloadPodSpec, policy ImagePolicy) {
+	require.NotEmpty(t, workloads, "There should be at least one workload to check")
+
+	var violations []string
+	for _, workload := range workloads {
+		for _, violation := range CheckImagePolicy(workload, policy) {
+			violations = append(violations, violation.String())
+		}
+	}
+	require.Empty(t, violations, "Images should satisfy the image policy")
+}
+
+// ImagePolicyFromEnv builds the policy for live scenarios from IMAGE_ALLOWED_REGISTRIES
+// (comma-separated) and IMAGE_REQUIRE_DIGEST. The latest tag is always rejected.
+func ImagePolicyFromEnv() ImagePolicy {
+	policy := ImagePolicy{
+		RequireDigest: os.Getenv("IMAGE_REQUIRE_DIGEST") == "true",
+		ForbidLatest:  true,
+	}
+	for _, registry := range strings.Split(os.Getenv("IMAGE_ALLOWED_REGISTRIES"), ",") {
+		if registry = strings.TrimSpace(registry); registry != "" {
+			policy.AllowedRegistries = append(policy.AllowedRegistries, registry)
+		}
+	}
+	return policy
+}
+
+func registryAllowed(image ImageReference, allowed []string) bool {
+	location := image.Registry + "/" + image.Repository
+	for _, entry := range allowed {
+		entry = strings.TrimSuffix(entry, "/")
+		if entry == image.Registry || strings.HasPrefix(location, entry+"/") {
+			return true
+		}
+	}
+	return false
+}
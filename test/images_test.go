@@ -0,0 +1,111 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	testCases := []struct {
+		ref      string
+		expected ImageReference
+		hasError bool
+	}{
+		{ref: "busybox", expected: ImageReference{Registry: "docker.io", Repository: "library/busybox"}},
+		{ref: "harness/delegate:24.07.83404", expected: ImageReference{Registry: "docker.io", Repository: "harness/delegate", Tag: "24.07.83404"}},
+		{ref: "localhost:5000/harness/delegate:24.07.83404.minimal", expected: ImageReference{Registry: "localhost:5000", Repository: "harness/delegate", Tag: "24.07.83404.minimal"}},
+		{ref: "registry.example.com/harness/upgrader@" + digest, expected: ImageReference{Registry: "registry.example.com", Repository: "harness/upgrader", Digest: digest}},
+		{ref: "us-docker.pkg.dev/gar-prod-setup/harness-public/harness/delegate:24.07.83404", expected: ImageReference{Registry: "us-docker.pkg.dev", Repository: "gar-prod-setup/harness-public/harness/delegate", Tag: "24.07.83404"}},
+		{ref: "", hasError: true},
+		{ref: "harness/delegate@sha256:abc", hasError: true},
+		{ref: "Harness/Delegate:1", hasError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			image, err := ParseImageReference(tc.ref)
+			if tc.hasError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, image)
+		})
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("b", 64)
+	mirror := ImagePolicy{AllowedRegistries: []string{"registry.example.com/harness"}, ForbidLatest: true}
+	delegate := ImagePolicy{ForbidLatest: true, TagPattern: DelegateVersionPattern}
+
+	testCases := []struct {
+		name    string
+		ref     string
+		policy  ImagePolicy
+		reasons int
+	}{
+		{name: "mirror allowed", ref: "registry.example.com/harness/delegate:24.07.83404", policy: mirror},
+		{name: "mirror wrong prefix", ref: "registry.example.com/other/delegate:24.07.83404", policy: mirror, reasons: 1},
+		{name: "docker hub not allowed", ref: "harness/delegate:24.07.83404", policy: mirror, reasons: 1},
+		{name: "latest tag", ref: "harness/delegate:latest", policy: delegate, reasons: 2},
+		{name: "no tag", ref: "harness/delegate", policy: delegate, reasons: 1},
+		{name: "digest without tag", ref: "harness/delegate@" + digest, policy: ImagePolicy{ForbidLatest: true, RequireDigest: true}},
+		{name: "digest required", ref: "harness/delegate:24.07.83404", policy: ImagePolicy{RequireDigest: true}, reasons: 1},
+		{name: "delegate version", ref: "harness/delegate:24.07.83404.minimal", policy: delegate},
+		{name: "bad delegate version", ref: "harness/delegate:1.0.0", policy: delegate, reasons: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reasons := CheckImage(tc.ref, tc.policy)
+			assert.Len(t, reasons, tc.reasons, "%v", reasons)
+		})
+	}
+}
+
+func TestRenderedDelegateImages(t *testing.T) {
+	testCases := []struct {
+		name               string
+		delegateImage      string
+		upgraderImage      string
+		delegateViolations bool
+		upgraderViolations bool
+	}{
+		{name: "pinned", delegateImage: "harness/delegate:24.07.83404", upgraderImage: "harness/upgrader:1.0.2"},
+		{name: "latest delegate", delegateImage: "harness/delegate:latest", upgraderImage: "harness/upgrader:1.0.2", delegateViolations: true},
+		{name: "latest upgrader", delegateImage: "harness/delegate:24.07.83404", upgraderImage: "harness/upgrader:latest", upgraderViolations: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+			vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+			vars["delegate_image"] = tc.delegateImage
+			vars["upgrader_image"] = tc.upgraderImage
+			vars["upgrader_enabled"] = true
+
+			workloads := RenderedWorkloads(t, &terraform.Options{
+				TerraformDir: CopyModuleDir(t),
+				Vars:         vars,
+			})
+
+			delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+			violations := CheckImagePolicy(delegate, ImagePolicy{ForbidLatest: true, TagPattern: DelegateVersionPattern})
+			assert.Equal(t, tc.delegateViolations, len(violations) > 0, "%v", violations)
+
+			upgrader := FindWorkload(t, workloads, "CronJob", fmt.Sprintf("%s-upgrader-job", delegateName))
+			assert.Equal(t, tc.upgraderImage, upgrader.Template.Spec.Containers[0].Image)
+			violations = CheckImagePolicy(upgrader, ImagePolicy{ForbidLatest: true})
+			assert.Equal(t, tc.upgraderViolations, len(violations) > 0, "%v", violations)
+		})
+	}
+}
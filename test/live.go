@@ -0,0 +1,84 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/joho/godotenv"
+)
+
+// LiveDelegateEnv holds the delegate settings of the live tests, from the environment or test/.env
+type LiveDelegateEnv struct {
+	AccountID       string
+	DelegateToken   string
+	DelegateImage   string
+	ManagerEndpoint string
+}
+
+// LoadLiveDelegateEnv reads the LiveDelegateEnv, loading test/.env first, and registers the token
+// with the Redactor, including for tests that never pass it to Terraform
+func LoadLiveDelegateEnv() LiveDelegateEnv {
+	// Variables already set in the environment win over the file
+	_ = godotenv.Load(".env")
+	env := LiveDelegateEnv{
+		AccountID:       os.Getenv("ACCOUNT_ID"),
+		DelegateToken:   os.Getenv("DELEGATE_TOKEN"),
+		DelegateImage:   os.Getenv("DELEGATE_IMAGE"),
+		ManagerEndpoint: os.Getenv("MANAGER_ENDPOINT"),
+	}
+	Redactor.RegisterSecret(env.DelegateToken)
+	return env
+}
+
+// LiveTerraformOptions is LiveTerraformOptionsOn the default cluster target
+func LiveTerraformOptions(t *testing.T, testNamespace *TestNamespace, delegateName string, overrides map[string]interface{}) *terraform.Options {
+	return LiveTerraformOptionsOn(t, DefaultClusterTarget(), testNamespace, delegateName, overrides)
+}
+
+// LiveTerraformOptionsOn returns the options deploying delegateName to the test namespace on target,
+// in a copy of the module, with the LiveDelegateEnv settings, a single replica and no upgrader.
+// overrides are applied last, and a nil override removes the variable. The secret variables are
+// passed through the environment and registered with the Redactor, and the release is destroyed
+// when the test completes, before the namespace is deleted.
+func LiveTerraformOptionsOn(t *testing.T, target ClusterTarget, testNamespace *TestNamespace, delegateName string, overrides map[string]interface{}) *terraform.Options {
+	env := LoadLiveDelegateEnv()
+	vars := map[string]interface{}{
+		"namespace":        testNamespace.Name,
+		"delegate_name":    delegateName,
+		"account_id":       env.AccountID,
+		"delegate_token":   env.DelegateToken,
+		"delegate_image":   env.DelegateImage,
+		"manager_endpoint": env.ManagerEndpoint,
+		"replicas":         1,
+		"upgrader_enabled": false,
+		"create_namespace": false,
+		// Lets the sweeper find the release if the run dies before destroying it
+		"common_labels": testNamespace.Labels,
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(vars, name)
+			continue
+		}
+		vars[name] = value
+	}
+
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	})
+
+	// Secrets go through the environment, out of the logged command line
+	MoveSecretVarsToEnv(t, terraformOptions)
+
+	// Point the helm provider at the cluster of the test's helpers
+	target.ConfigureTerraform(t, terraformOptions, testNamespace.KubectlOptions)
+
+	// Cleanups run in reverse order, so this runs before AllocateNamespace's
+	t.Cleanup(func() {
+		terraform.Destroy(t, terraformOptions)
+	})
+
+	return terraformOptions
+}
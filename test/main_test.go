@@ -0,0 +1,31 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/joho/godotenv"
+)
+
+func TestMain(m *testing.M) {
+	// Load the secrets from the .env file before any test can log them
+	_ = godotenv.Load(".env")
+	InstallRedactor()
+	InstallIaCBinary()
+
+	removeStagedModule, err := InstallHelmProviderVersion()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Pinning the helm provider version: %v\n", err)
+		os.Exit(1)
+	}
+	removeProviderConfig, err := InstallProviderConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuring provider installation: %v\n", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	removeProviderConfig()
+	removeStagedModule()
+	os.Exit(code)
+}
@@ -0,0 +1,358 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultHelmRepository = "https://app.harness.io/storage/harness-download/delegate-helm-chart/"
+	defaultChart          = "harness-delegate-ng"
+)
+
+// ManifestObject is a single Kubernetes object from a rendered or released manifest
+type ManifestObject struct {
+	APIVersion string
+	Kind       string
+	Metadata   metav1.ObjectMeta
+	// Raw holds the JSON encoding of the whole object
+	Raw []byte
+}
+
+// Decode unmarshals the object into a typed client-go struct
+func (o ManifestObject) Decode(into interface{}) error {
+	return json.Unmarshal(o.Raw, into)
+}
+
+// String returns the object as Kind/name
+func (o ManifestObject) String() string {
+	return fmt.Sprintf("%s/%s", o.Kind, o.Metadata.Name)
+}
+
+// WorkloadPodSpec is the pod template of a workload, or the spec of a live pod
+type WorkloadPodSpec struct {
+	Kind     string
+	Name     string
+	Template corev1.PodTemplateSpec
+}
+
+// String returns the workload as Kind/name
+func (w WorkloadPodSpec) String() string {
+	return fmt.Sprintf("%s/%s", w.Kind, w.Name)
+}
+
+// ParseManifest splits a multi-document YAML manifest (from `helm template` or `helm get manifest`)
+// into objects, skipping empty documents
+func ParseManifest(manifest string) ([]ManifestObject, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(manifest)))
+
+	var objects []ManifestObject
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		var header struct {
+			metav1.TypeMeta `json:",inline"`
+			Metadata        metav1.ObjectMeta `json:"metadata"`
+		}
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return nil, err
+		}
+		if header.Kind == "" {
+			continue
+		}
+
+		objects = append(objects, ManifestObject{
+			APIVersion: header.APIVersion,
+			Kind:       header.Kind,
+			Metadata:   header.Metadata,
+			Raw:        raw,
+		})
+	}
+
+	return objects, nil
+}
+
+// PodSpecsFromManifest extracts the pod templates of every workload in objects
+func PodSpecsFromManifest(objects []ManifestObject) ([]WorkloadPodSpec, error) {
+	var workloads []WorkloadPodSpec
+
+	for _, object := range objects {
+		var template corev1.PodTemplateSpec
+
+		switch object.Kind {
+		case "Deployment":
+			var deployment appsv1.Deployment
+			if err := object.Decode(&deployment); err != nil {
+				return nil, err
+			}
+			template = deployment.Spec.Template
+		case "StatefulSet":
+			var statefulSet appsv1.StatefulSet
+			if err := object.Decode(&statefulSet); err != nil {
+				return nil, err
+			}
+			template = statefulSet.Spec.Template
+		case "DaemonSet":
+			var daemonSet appsv1.DaemonSet
+			if err := object.Decode(&daemonSet); err != nil {
+				return nil, err
+			}
+			template = daemonSet.Spec.Template
+		case "Job":
+			var job batchv1.Job
+			if err := object.Decode(&job); err != nil {
+				return nil, err
+			}
+			template = job.Spec.Template
+		case "CronJob":
+			var cronJob batchv1.CronJob
+			if err := object.Decode(&cronJob); err != nil {
+				return nil, err
+			}
+			template = cronJob.Spec.JobTemplate.Spec.Template
+		case "Pod":
+			var pod corev1.Pod
+			if err := object.Decode(&pod); err != nil {
+				return nil, err
+			}
+			template = corev1.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec}
+		default:
+			continue
+		}
+
+		workloads = append(workloads, WorkloadPodSpec{Kind: object.Kind, Name: object.Metadata.Name, Template: template})
+	}
+
+	return workloads, nil
+}
+
+// PodSpecsFromPods wraps live pods so they can be checked by the same validators as rendered manifests
+func PodSpecsFromPods(pods []corev1.Pod) []WorkloadPodSpec {
+	workloads := make([]WorkloadPodSpec, 0, len(pods))
+	for _, pod := range pods {
+		workloads = append(workloads, WorkloadPodSpec{
+			Kind:     "Pod",
+			Name:     pod.Name,
+			Template: corev1.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec},
+		})
+	}
+	return workloads
+}
+
+// FindWorkload returns the workload with the given kind and name
+func FindWorkload(t *testing.T, workloads []WorkloadPodSpec, kind, name string) WorkloadPodSpec {
+	for _, workload := range workloads {
+		if workload.Kind == kind && workload.Name == name {
+			return workload
+		}
+	}
+	require.Failf(t, "workload not found", "%s/%s is not in the manifest", kind, name)
+	return WorkloadPodSpec{}
+}
+
+// ResolveRenderedEnvMap is the offline counterpart of ResolveContainerEnvMap. It resolves
+// env and envFrom references against the ConfigMaps and Secrets in a rendered manifest.
+func ResolveRenderedEnvMap(t *testing.T, objects []ManifestObject, container corev1.Container) map[string]string {
+	configMaps := make(map[string]map[string]string)
+	secrets := make(map[string]map[string]string)
+
+	for _, object := range objects {
+		switch object.Kind {
+		case "ConfigMap":
+			var configMap corev1.ConfigMap
+			require.NoError(t, object.Decode(&configMap))
+			configMaps[configMap.Name] = configMap.Data
+		case "Secret":
+			var secret corev1.Secret
+			require.NoError(t, object.Decode(&secret))
+			data := make(map[string]string)
+			for k, v := range secret.Data {
+				data[k] = string(v)
+			}
+			for k, v := range secret.StringData {
+				data[k] = v
+			}
+			secrets[secret.Name] = data
+		}
+	}
+
+	result := make(map[string]string)
+
+	// 1) explicit env vars
+	for _, e := range container.Env {
+		if e.Value != "" {
+			result[e.Name] = e.Value
+			continue
+		}
+		if e.ValueFrom == nil {
+			continue
+		}
+		if cmRef := e.ValueFrom.ConfigMapKeyRef; cmRef != nil {
+			if v, ok := configMaps[cmRef.Name][cmRef.Key]; ok {
+				result[e.Name] = v
+			}
+		}
+		if secRef := e.ValueFrom.SecretKeyRef; secRef != nil {
+			if v, ok := secrets[secRef.Name][secRef.Key]; ok {
+				result[e.Name] = v
+			}
+		}
+	}
+
+	// 2) envFrom (bulk import)
+	for _, ef := range container.EnvFrom {
+		var data map[string]string
+		if ef.ConfigMapRef != nil {
+			data = configMaps[ef.ConfigMapRef.Name]
+		}
+		if ef.SecretRef != nil {
+			data = secrets[ef.SecretRef.Name]
+		}
+		for k, v := range data {
+			if _, exists := result[ef.Prefix+k]; !exists {
+				result[ef.Prefix+k] = v
+			}
+		}
+	}
+
+	return result
+}
+
+// RenderDelegateValues plans only the values data source of the module and returns the merged
+// values YAML from the `values` output. No cluster access is required.
+func RenderDelegateValues(t *testing.T, terraformOptions *terraform.Options) string {
+	options, err := terraformOptions.Clone()
+	require.NoError(t, err)
+	// The clone does not keep the logger
+	options.Logger = terraformOptions.Logger
+	options.Targets = []string{"data.utils_deep_merge_yaml.values"}
+	options.PlanFilePath = filepath.Join(t.TempDir(), "values.tfplan")
+
+	plan := terraform.InitAndPlanAndShowWithStruct(t, options)
+
+	change, ok := plan.RawPlan.OutputChanges["values"]
+	require.True(t, ok, "Plan should contain the values output")
+
+	values, ok := change.After.(string)
+	require.True(t, ok, "values output should be a known string at plan time")
+
+	return values
+}
+
+// RenderDelegateManifest renders the delegate chart with `helm template` using the values produced
+// by the module. The chart source is taken from the terraform variables, falling back to the module defaults.
+func RenderDelegateManifest(t *testing.T, terraformOptions *terraform.Options) string {
+	return RenderDelegateManifestFromValues(t, terraformOptions, RenderDelegateValues(t, terraformOptions))
+}
+
+// RenderDelegateManifestFromValues renders the delegate chart with `helm template` using values
+// already rendered by RenderDelegateValues
+func RenderDelegateManifestFromValues(t *testing.T, terraformOptions *terraform.Options, values string) string {
+	valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte(values), 0600))
+
+	releaseName := stringVar(terraformOptions.Vars, "delegate_name", "")
+	namespace := stringVar(terraformOptions.Vars, "namespace", "harness-delegate-ng")
+	repository := stringVar(terraformOptions.Vars, "helm_repository", defaultHelmRepository)
+	chart := stringVar(terraformOptions.Vars, "chart", defaultChart)
+	chartVersion := stringVar(terraformOptions.Vars, "chart_version", "")
+
+	helmOptions := &helm.Options{
+		ValuesFiles: []string{valuesFile},
+		Logger:      terraformOptions.Logger,
+	}
+
+	// Offline, a chart repository is replaced with the pre-downloaded chart archive
+	if Offline() && repository != "" && !strings.HasPrefix(repository, "oci://") {
+		archive := os.Getenv("MIRROR_CHART_ARCHIVE")
+		if archive == "" {
+			RefuseNetwork(t, fmt.Sprintf("chart %s from %s (set MIRROR_CHART_ARCHIVE)", chart, repository))
+		}
+		repository, chart = "", archive
+	}
+
+	// Resolve the chart the same way the helm provider does: OCI repositories are prefixed
+	// to the chart name, and an empty repository means chart is a local path
+	args := []string{releaseName}
+	switch {
+	case strings.HasPrefix(repository, "oci://"):
+		args = append(args, strings.TrimSuffix(repository, "/")+"/"+chart)
+	case repository != "":
+		args = append(args, chart, "--repo", repository)
+	default:
+		args = append(args, chart)
+	}
+	args = append(args, "--namespace", namespace)
+	if strings.HasPrefix(repository, "oci://") && PlainHTTPRegistry(repository) {
+		args = append(args, "--plain-http")
+	}
+	if chartVersion != "" {
+		args = append(args, "--version", chartVersion)
+	}
+
+	manifest, err := helm.RunHelmCommandAndGetStdOutE(t, helmOptions, "template", args...)
+	require.NoError(t, err)
+
+	return manifest
+}
+
+// GetReleaseManifest returns the manifest of a deployed release from `helm get manifest`
+func GetReleaseManifest(t *testing.T, kubectlOptions *k8s.KubectlOptions, releaseName string) string {
+	helmOptions := &helm.Options{
+		KubectlOptions: kubectlOptions,
+	}
+
+	manifest, err := helm.RunHelmCommandAndGetStdOutE(t, helmOptions, "get", "manifest", releaseName, "-n", kubectlOptions.Namespace)
+	require.NoError(t, err)
+
+	return manifest
+}
+
+// RenderedWorkloads renders the delegate chart offline and returns its workloads
+func RenderedWorkloads(t *testing.T, terraformOptions *terraform.Options) []WorkloadPodSpec {
+	objects, err := ParseManifest(RenderDelegateManifest(t, terraformOptions))
+	require.NoError(t, err)
+
+	workloads, err := PodSpecsFromManifest(objects)
+	require.NoError(t, err)
+
+	return workloads
+}
+
+func stringVar(vars map[string]interface{}, key, fallback string) string {
+	if value, ok := vars[key].(string); ok {
+		return value
+	}
+	return fallback
+}
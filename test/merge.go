@@ -0,0 +1,83 @@
+package test
+
+import (
+	"fmt"
+
+	"github.com/imdario/mergo"
+	"sigs.k8s.io/yaml"
+)
+
+// ModuleValuesFixture holds the module's values document for DefaultTerraformVars, the base the
+// merge properties are checked against
+const ModuleValuesFixture = "testdata/merge/module-values.yaml"
+
+// DeepMergeYAML models the module's utils_deep_merge_yaml data source: the documents are merged in
+// order with mergo and the override option, as the cloudposse/utils provider does. Empty documents
+// are skipped like compact() does, and every other document must be a map. Notable semantics:
+//   - maps merge key by key, later documents win
+//   - lists are replaced whole, never appended
+//   - null replaces a value, which helm then drops
+//   - a map never replaces a scalar, while a scalar or a list replaces a map
+func DeepMergeYAML(documents ...string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for i, document := range documents {
+		if document == "" {
+			continue
+		}
+		var doc interface{}
+		if err := yaml.Unmarshal([]byte(document), &doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if doc == nil {
+			continue
+		}
+		values, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("document %d: top level is %T, not a map", i, doc)
+		}
+		if err := mergo.Merge(&merged, values, mergo.WithOverride); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return merged, nil
+}
+
+// ValuesLeaf is a value of a values document that is not a non-empty map, with the keys leading to
+// it. Keys are kept apart since chart keys may contain dots and slashes.
+type ValuesLeaf struct {
+	Path  []string
+	Value interface{}
+}
+
+// ValuesLeaves returns every leaf of values
+func ValuesLeaves(values map[string]interface{}) []ValuesLeaf {
+	var leaves []ValuesLeaf
+	var walk func(prefix []string, node map[string]interface{})
+	walk = func(prefix []string, node map[string]interface{}) {
+		for key, value := range node {
+			path := append(append([]string{}, prefix...), key)
+			if child, ok := value.(map[string]interface{}); ok && len(child) > 0 {
+				walk(path, child)
+				continue
+			}
+			leaves = append(leaves, ValuesLeaf{Path: path, Value: value})
+		}
+	}
+	walk(nil, values)
+	return leaves
+}
+
+// ValuesAt returns the value at path, and whether every key along the path is set
+func ValuesAt(values map[string]interface{}, path []string) (interface{}, bool) {
+	var node interface{} = values
+	for _, key := range path {
+		parent, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = parent[key]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
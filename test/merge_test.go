@@ -0,0 +1,268 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func TestModuleValuesFixture(t *testing.T) {
+	contract, err := ParseModuleContract(ModuleDir)
+	require.NoError(t, err)
+	base, err := DeepMergeYAML(loadModuleValues(t))
+	require.NoError(t, err)
+
+	keys := make([]string, 0, len(base))
+	for key := range base {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	assert.Equal(t, contract.ValuesKeys, keys, "%s should have the keys of the module's values document", ModuleValuesFixture)
+}
+
+func TestDeepMergeYAML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		overlay  string
+		expected string
+	}{
+		{name: "nested maps merge", overlay: "upgrader: {enabled: true}", expected: "upgrader: {enabled: true, imagePullSecrets: [{name: pull}]}"},
+		{name: "lists are replaced", overlay: "tolerations: [{key: b}]", expected: "tolerations: [{key: b}]"},
+		{name: "empty list replaces", overlay: "tolerations: []", expected: "tolerations: []"},
+		{name: "false overrides true", overlay: "nextGen: false", expected: "nextGen: false"},
+		{name: "empty string overrides", overlay: "accountId: ''", expected: "accountId: ''"},
+		{name: "null overrides", overlay: "accountId: null", expected: "accountId: null"},
+		{name: "null overrides a map", overlay: "upgrader: null", expected: "upgrader: null"},
+		{name: "empty map keeps the map", overlay: "upgrader: {}", expected: "upgrader: {enabled: false, imagePullSecrets: [{name: pull}]}"},
+		{name: "scalar replaces a map", overlay: "upgrader: off", expected: "upgrader: off"},
+		{name: "map does not replace a scalar", overlay: "accountId: {id: abc}", expected: "accountId: abc"},
+		{name: "map does not replace a list", overlay: "tolerations: {key: b}", expected: "tolerations: [{key: a}]"},
+		{name: "new keys are added", overlay: "javaOpts: -Xmx1G", expected: "javaOpts: -Xmx1G"},
+	}
+
+	base := "accountId: abc\nnextGen: true\ntolerations: [{key: a}]\nupgrader: {enabled: false, imagePullSecrets: [{name: pull}]}\n"
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := DeepMergeYAML(base, tc.overlay)
+			require.NoError(t, err)
+			// The base with the expected top-level keys replaced
+			var expected, replaced map[string]interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(base), &expected))
+			require.NoError(t, yaml.Unmarshal([]byte(tc.expected), &replaced))
+			for key, value := range replaced {
+				expected[key] = value
+			}
+			assert.Equal(t, expected, merged)
+		})
+	}
+
+	_, err := DeepMergeYAML(base, "- a list")
+	assert.Error(t, err, "A top level list should not merge")
+	_, err = DeepMergeYAML(base, "key: [unterminated")
+	assert.Error(t, err)
+}
+
+// mergeSeed is an overlay the merge is checked with, by name
+type mergeSeed struct {
+	name    string
+	overlay string
+}
+
+// mergeSeeds returns the overlays the suite deploys, and the edge cases that broke merges before
+func mergeSeeds(tb testing.TB) []mergeSeed {
+	overlays, err := filepath.Glob("testdata/overlays/*.yaml")
+	require.NoError(tb, err)
+	require.NotEmpty(tb, overlays)
+
+	var seeds []mergeSeed
+	for _, path := range overlays {
+		content, err := os.ReadFile(path)
+		require.NoError(tb, err)
+		seeds = append(seeds, mergeSeed{name: filepath.Base(path), overlay: string(content)})
+	}
+	for i, overlay := range []string{
+		"",
+		"{}",
+		"# only a comment\n",
+		"accountId: null\n",
+		"upgrader: null\n",
+		"upgrader:\n  enabled: true\n",
+		"tolerations: []\n",
+		"tolerations: {key: dedicated}\n",
+		"nodeSelector:\n  kubernetes.io/os: linux\n",
+		"replicas: \"2\"\n",
+		"nextGen: false\n",
+		"podAnnotations:\n  checksum/delegate-token: overridden\n",
+		"mTLS: disabled\n",
+		"- not a map\n",
+	} {
+		seeds = append(seeds, mergeSeed{name: fmt.Sprintf("edge-%d", i), overlay: overlay})
+	}
+	return seeds
+}
+
+func FuzzDeepMergeYAML(f *testing.F) {
+	for _, seed := range mergeSeeds(f) {
+		f.Add(seed.overlay)
+	}
+
+	base := loadModuleValues(f)
+	contract, err := ParseModuleContract(ModuleDir)
+	require.NoError(f, err)
+
+	f.Fuzz(func(t *testing.T, overlay string) {
+		checkMergeProperties(t, base, overlay, contract.ValuesKeys)
+	})
+}
+
+// TestRenderedValuesMergeParity checks DeepMergeYAML against the module: each seed overlay is
+// merged by utils_deep_merge_yaml onto the values document of the vars the fixture holds
+func TestRenderedValuesMergeParity(t *testing.T) {
+	base := loadModuleValues(t)
+
+	for _, seed := range mergeSeeds(t) {
+		seed := seed
+		var doc interface{}
+		if err := yaml.Unmarshal([]byte(seed.overlay), &doc); err != nil {
+			continue
+		}
+		if _, isMap := doc.(map[string]interface{}); doc != nil && !isMap {
+			continue
+		}
+
+		t.Run(seed.name, func(t *testing.T) {
+			t.Parallel()
+
+			expected, err := DeepMergeYAML(base, seed.overlay)
+			require.NoError(t, err)
+
+			vars := DefaultTerraformVars("harness-delegate-ng", "test-delegate")
+			vars["values"] = seed.overlay
+			values := RenderDelegateValues(t, &terraform.Options{TerraformDir: CopyModuleDir(t), Vars: vars})
+
+			var rendered map[string]interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(values), &rendered))
+			assert.Equal(t, expected, rendered, "The module should merge %q as DeepMergeYAML does", seed.overlay)
+		})
+	}
+}
+
+func loadModuleValues(tb testing.TB) string {
+	content, err := os.ReadFile(ModuleValuesFixture)
+	require.NoError(tb, err)
+	return string(content)
+}
+
+// checkMergeProperties checks the invariants of merging overlay onto the base values document
+func checkMergeProperties(t *testing.T, base, overlay string, requiredKeys []string) {
+	baseValues, err := DeepMergeYAML(base)
+	require.NoError(t, err)
+
+	// An empty overlay is the identity
+	for _, empty := range []string{"", "{}", "# comment\n"} {
+		merged, err := DeepMergeYAML(base, empty)
+		require.NoError(t, err)
+		require.Equal(t, baseValues, merged, "Merging %q should not change the values", empty)
+	}
+
+	var doc interface{}
+	if yaml.Unmarshal([]byte(overlay), &doc) != nil {
+		_, err := DeepMergeYAML(base, overlay)
+		require.Error(t, err, "An overlay that does not parse should not merge")
+		return
+	}
+	overlayValues, isMap := doc.(map[string]interface{})
+	merged, err := DeepMergeYAML(base, overlay)
+	if doc != nil && !isMap {
+		require.Error(t, err, "An overlay that is not a map should not merge")
+		return
+	}
+	require.NoError(t, err)
+
+	// Required keys survive unless the overlay sets them
+	for _, key := range requiredKeys {
+		if _, overridden := overlayValues[key]; overridden {
+			continue
+		}
+		require.Contains(t, merged, key, "Required key %s should survive the overlay", key)
+		require.Equal(t, baseValues[key], merged[key], "Required key %s should keep its value", key)
+	}
+
+	// Base leaves survive unless the overlay sets a value on their path other than a map
+	for _, leaf := range ValuesLeaves(baseValues) {
+		if overlaySets(overlayValues, leaf.Path) {
+			continue
+		}
+		value, ok := ValuesAt(merged, leaf.Path)
+		require.True(t, ok, "%q should survive the overlay", leaf.Path)
+		require.Equal(t, leaf.Value, value, "%q should keep its value", leaf.Path)
+	}
+
+	// Overlay leaves win, unless the base holds a value other than a map on their path
+	for _, leaf := range ValuesLeaves(overlayValues) {
+		if empty, ok := leaf.Value.(map[string]interface{}); ok && len(empty) == 0 {
+			continue
+		}
+		if baseBlocks(baseValues, leaf.Path) {
+			continue
+		}
+		value, ok := ValuesAt(merged, leaf.Path)
+		require.True(t, ok, "%q should be set by the overlay", leaf.Path)
+		require.Equal(t, leaf.Value, value, "%q should take the overlay value", leaf.Path)
+	}
+
+	// Only keys of the base or the overlay are merged in
+	for key := range merged {
+		_, inBase := baseValues[key]
+		_, inOverlay := overlayValues[key]
+		require.True(t, inBase || inOverlay, "Key %s should come from the base or the overlay", key)
+	}
+
+	// Applying the overlay twice changes nothing
+	twice, err := DeepMergeYAML(base, overlay, overlay)
+	require.NoError(t, err)
+	require.Equal(t, merged, twice, "Merging is idempotent")
+
+	// The rendered document reads back as the same values
+	rendered, err := yaml.Marshal(merged)
+	require.NoError(t, err)
+	reread, err := DeepMergeYAML(string(rendered))
+	require.NoError(t, err)
+	require.Equal(t, merged, reread, "Rendered values should read back unchanged")
+}
+
+// overlaySets reports whether overlay holds a value other than a map at path or along it
+func overlaySets(overlay map[string]interface{}, path []string) bool {
+	for i := range path {
+		value, ok := ValuesAt(overlay, path[:i+1])
+		if !ok {
+			return false
+		}
+		if _, isMap := value.(map[string]interface{}); !isMap || i == len(path)-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// baseBlocks reports whether base holds a value other than a map or null strictly along path,
+// which a map from the overlay does not replace
+func baseBlocks(base map[string]interface{}, path []string) bool {
+	for i := 1; i < len(path); i++ {
+		value, ok := ValuesAt(base, path[:i])
+		if !ok || value == nil {
+			return false
+		}
+		if _, isMap := value.(map[string]interface{}); !isMap {
+			return true
+		}
+	}
+	return false
+}
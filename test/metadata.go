@@ -0,0 +1,104 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ObjectMetadata holds the labels and annotations every object of the release should carry
+type ObjectMetadata struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// MetadataViolation lists the labels and annotations an object is missing
+type MetadataViolation struct {
+	// Object is Kind/name, with a "(pod template)" suffix for the pods of a workload
+	Object  string
+	Missing []string
+}
+
+// String returns the object followed by what it is missing
+func (v MetadataViolation) String() string {
+	return fmt.Sprintf("%s: missing %s", v.Object, strings.Join(v.Missing, ", "))
+}
+
+// CheckObjectMetadata checks every object, and the pod template of every workload, for the
+// expected labels and annotations
+func CheckObjectMetadata(objects []ManifestObject, expected ObjectMetadata) ([]MetadataViolation, error) {
+	var violations []MetadataViolation
+
+	for _, object := range objects {
+		if missing := missingMetadata(object.Metadata, expected); len(missing) > 0 {
+			violations = append(violations, MetadataViolation{Object: object.String(), Missing: missing})
+		}
+	}
+
+	workloads, err := PodSpecsFromManifest(objects)
+	if err != nil {
+		return nil, err
+	}
+	for _, workload := range workloads {
+		if workload.Kind == "Pod" {
+			continue
+		}
+		if missing := missingMetadata(workload.Template.ObjectMeta, expected); len(missing) > 0 {
+			violations = append(violations, MetadataViolation{Object: workload.String() + " (pod template)", Missing: missing})
+		}
+	}
+
+	return violations, nil
+}
+
+// ValidateObjectMetadata validates that every object carries the expected labels and annotations
+// and reports every object that does not
+func ValidateObjectMetadata(t *testing.T, objects []ManifestObject, expected ObjectMetadata) {
+	violations, err := CheckObjectMetadata(objects, expected)
+	require.NoError(t, err)
+
+	var report []string
+	for _, violation := range violations {
+		report = append(report, violation.String())
+	}
+	require.Empty(t, report, "Objects are missing the common labels/annotations")
+}
+
+// ValidateReleaseMetadata validates the objects of a deployed release from `helm get manifest`
+// and the live pods of its workloads
+func ValidateReleaseMetadata(t *testing.T, kubectlOptions *k8s.KubectlOptions, releaseName string, expected ObjectMetadata) {
+	objects, err := ParseManifest(GetReleaseManifest(t, kubectlOptions, releaseName))
+	require.NoError(t, err)
+	require.NotEmpty(t, objects, "Release %s should have objects", releaseName)
+	ValidateObjectMetadata(t, objects, expected)
+
+	// Live pods are not in the manifest, so check them separately
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/instance=%s", releaseName),
+	})
+	for _, pod := range pods {
+		missing := missingMetadata(pod.ObjectMeta, expected)
+		require.Empty(t, missing, "Pod %s is missing the common labels/annotations", pod.Name)
+	}
+}
+
+func missingMetadata(meta metav1.ObjectMeta, expected ObjectMetadata) []string {
+	var missing []string
+	for key, value := range expected.Labels {
+		if actual, ok := meta.Labels[key]; !ok || actual != value {
+			missing = append(missing, fmt.Sprintf("label %s=%s", key, value))
+		}
+	}
+	for key, value := range expected.Annotations {
+		if actual, ok := meta.Annotations[key]; !ok || actual != value {
+			missing = append(missing, fmt.Sprintf("annotation %s=%s", key, value))
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckObjectMetadata(t *testing.T) {
+	manifest := `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: delegate
+  labels:
+    cost-center: platform
+  annotations:
+    owner: delegates
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: delegate
+  labels:
+    cost-center: other
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: delegate
+  labels:
+    cost-center: platform
+  annotations:
+    owner: delegates
+spec:
+  template:
+    metadata:
+      labels:
+        cost-center: platform
+    spec:
+      containers:
+        - name: delegate
+          image: harness/delegate:24.07.83404
+`
+	objects, err := ParseManifest(manifest)
+	require.NoError(t, err)
+
+	violations, err := CheckObjectMetadata(objects, ObjectMetadata{
+		Labels:      map[string]string{"cost-center": "platform"},
+		Annotations: map[string]string{"owner": "delegates"},
+	})
+	require.NoError(t, err)
+
+	var report []string
+	for _, violation := range violations {
+		report = append(report, violation.String())
+	}
+	assert.Equal(t, []string{
+		"Secret/delegate: missing annotation owner=delegates, label cost-center=platform",
+		"Deployment/delegate (pod template): missing annotation owner=delegates",
+	}, report)
+}
+
+func TestRenderedDelegateMetadata(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	expected := ObjectMetadata{
+		Labels:      map[string]string{"cost-center": "platform", "team": "delegates"},
+		Annotations: map[string]string{"example.com/owner": "platform-team"},
+	}
+
+	vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+	vars["upgrader_enabled"] = true
+	vars["common_labels"] = expected.Labels
+	vars["common_annotations"] = expected.Annotations
+
+	objects, err := ParseManifest(RenderDelegateManifest(t, &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	}))
+	require.NoError(t, err)
+
+	ValidateObjectMetadata(t, objects, expected)
+}
+
+func TestDelegateCommonMetadata(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	replicas := 1
+
+	expected := ObjectMetadata{
+		Labels:      map[string]string{"cost-center": "platform", "test-run": strings.ToLower(uniqueID)},
+		Annotations: map[string]string{"example.com/owner": "platform-team"},
+	}
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas":           replicas,
+		"upgrader_enabled":   true,
+		"common_labels":      expected.Labels,
+		"common_annotations": expected.Annotations,
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Get the Kubernetes config path
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Every released object and every live pod must carry the common metadata
+	ValidateReleaseMetadata(t, kubectlOptions, delegateName, expected)
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceSnapshot records the objects of a namespace at a point in time
+type NamespaceSnapshot struct {
+	Namespace string
+	Exists    bool
+	// Objects maps Kind/name to the object UID, so that re-created objects are detected
+	Objects map[string]string
+}
+
+// SnapshotDiff lists the objects that differ between two snapshots, as sorted Kind/name keys
+type SnapshotDiff struct {
+	Removed []string
+	Added   []string
+	// Replaced objects have the same name but a different UID, i.e. were deleted and re-created
+	Replaced []string
+}
+
+// Empty reports whether the snapshots hold the same objects
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Removed) == 0 && len(d.Added) == 0 && len(d.Replaced) == 0
+}
+
+// snapshotKinds are the kinds the module, the chart or a namespace owner typically create
+var snapshotKinds = []string{
+	"configmaps", "secrets", "serviceaccounts", "services", "resourcequotas", "limitranges",
+	"persistentvolumeclaims", "deployments", "cronjobs", "jobs", "roles", "rolebindings",
+}
+
+// SnapshotNamespace records the objects of the namespace of kubectlOptions. A missing namespace
+// gives an empty snapshot with Exists unset. Only kind, name and UID are read, so no Secret data
+// ends up in the test log.
+func SnapshotNamespace(t *testing.T, kubectlOptions *k8s.KubectlOptions) NamespaceSnapshot {
+	snapshot := NamespaceSnapshot{Namespace: kubectlOptions.Namespace, Objects: make(map[string]string)}
+
+	if _, err := k8s.GetNamespaceE(t, kubectlOptions, kubectlOptions.Namespace); err != nil {
+		require.True(t, apierrors.IsNotFound(err), "Getting namespace %s: %v", kubectlOptions.Namespace, err)
+		return snapshot
+	}
+	snapshot.Exists = true
+
+	output, err := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, "get", strings.Join(snapshotKinds, ","),
+		"--no-headers", "-o", "custom-columns=KIND:.kind,NAME:.metadata.name,UID:.metadata.uid")
+	require.NoError(t, err)
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		snapshot.Objects[fmt.Sprintf("%s/%s", fields[0], fields[1])] = fields[2]
+	}
+	return snapshot
+}
+
+// DiffNamespaceSnapshots compares two snapshots of the same namespace
+func DiffNamespaceSnapshots(before, after NamespaceSnapshot) SnapshotDiff {
+	var diff SnapshotDiff
+	for key, uid := range before.Objects {
+		afterUID, ok := after.Objects[key]
+		switch {
+		case !ok:
+			diff.Removed = append(diff.Removed, key)
+		case afterUID != uid:
+			diff.Replaced = append(diff.Replaced, key)
+		}
+	}
+	for key := range after.Objects {
+		if _, ok := before.Objects[key]; !ok {
+			diff.Added = append(diff.Added, key)
+		}
+	}
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Replaced)
+	return diff
+}
+
+// ValidateNoCollateralDeletions validates that the namespace still exists and that every object
+// present before the module was applied survived, untouched, after it was destroyed. Objects
+// left behind by the module are reported too.
+func ValidateNoCollateralDeletions(t *testing.T, before, after NamespaceSnapshot) {
+	require.True(t, after.Exists, "Namespace %s should not be deleted", before.Namespace)
+
+	diff := DiffNamespaceSnapshots(before, after)
+	require.Empty(t, diff.Removed, "Objects deleted from namespace %s", before.Namespace)
+	require.Empty(t, diff.Replaced, "Objects re-created in namespace %s", before.Namespace)
+	require.Empty(t, diff.Added, "Objects left behind in namespace %s", before.Namespace)
+}
+
+// Guardrails roomy enough for a few delegate replicas
+var (
+	guardrailQuota = corev1.ResourceList{
+		corev1.ResourcePods:           resource.MustParse("10"),
+		corev1.ResourceRequestsCPU:    resource.MustParse("8"),
+		corev1.ResourceRequestsMemory: resource.MustParse("16Gi"),
+		corev1.ResourceLimitsMemory:   resource.MustParse("32Gi"),
+	}
+	guardrailContainerDefaults = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("1"),
+		corev1.ResourceMemory: resource.MustParse("2Gi"),
+	}
+)
+
+// CreateNamespaceGuardrails creates a ResourceQuota and a LimitRange named "guardrails" in the
+// namespace, as a platform team would for a shared namespace
+func CreateNamespaceGuardrails(t *testing.T, kubectlOptions *k8s.KubectlOptions) {
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+	namespace := kubectlOptions.Namespace
+
+	_, err = client.CoreV1().ResourceQuotas(namespace).Create(context.Background(), &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "guardrails", Namespace: namespace},
+		Spec:       corev1.ResourceQuotaSpec{Hard: guardrailQuota},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = client.CoreV1().LimitRanges(namespace).Create(context.Background(), &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "guardrails", Namespace: namespace},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type:           corev1.LimitTypeContainer,
+			Default:        guardrailContainerDefaults,
+			DefaultRequest: guardrailContainerDefaults,
+		}}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiffNamespaceSnapshots(t *testing.T) {
+	before := NamespaceSnapshot{Exists: true, Objects: map[string]string{
+		"ConfigMap/kube-root-ca.crt": "uid-1",
+		"ConfigMap/team-config":      "uid-2",
+		"ResourceQuota/guardrails":   "uid-3",
+		"Secret/team-secret":         "uid-4",
+	}}
+	after := NamespaceSnapshot{Exists: true, Objects: map[string]string{
+		"ConfigMap/kube-root-ca.crt": "uid-1",
+		"ConfigMap/team-config":      "uid-5",
+		"ResourceQuota/guardrails":   "uid-3",
+		"Secret/delegate":            "uid-6",
+	}}
+
+	diff := DiffNamespaceSnapshots(before, after)
+	assert.Equal(t, []string{"Secret/team-secret"}, diff.Removed)
+	assert.Equal(t, []string{"ConfigMap/team-config"}, diff.Replaced)
+	assert.Equal(t, []string{"Secret/delegate"}, diff.Added)
+	assert.False(t, diff.Empty())
+	assert.True(t, DiffNamespaceSnapshots(before, before).Empty())
+}
+
+func TestDelegateInExistingNamespace(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := strings.ToLower(random.UniqueId())
+	delegateName := fmt.Sprintf("test-delegate-%s", uniqueID)
+	replicas := 1
+
+	// A shared namespace owned by someone else, with quotas, defaults and objects of its own
+	testNamespace := AllocateNamespace(t, "harness-delegate-shared")
+	kubectlOptions := testNamespace.KubectlOptions
+	CreateNamespaceGuardrails(t, kubectlOptions)
+	k8s.RunKubectl(t, kubectlOptions, "create", "configmap", "team-config", "--from-literal=owner=another-team")
+
+	before := SnapshotNamespace(t, kubectlOptions)
+
+	for _, createNamespace := range []bool{false, true} {
+		t.Run(fmt.Sprintf("create_namespace=%t", createNamespace), func(t *testing.T) {
+			terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+				"replicas":         replicas,
+				"create_namespace": createNamespace,
+			})
+
+			// Run terraform init and apply
+			terraform.InitAndApply(t, terraformOptions)
+
+			// The delegate must fit in the quota, with the LimitRange defaults where it sets none
+			k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+			deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+			pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+				LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+			})
+			require.Equal(t, replicas, len(pods), "expected number of pods")
+			for _, container := range pods[0].Spec.Containers {
+				assert.False(t, container.Resources.Limits.Memory().IsZero(), "Container %s should have a memory limit", container.Name)
+			}
+
+			// Destroying the release must leave the namespace exactly as it was found
+			terraform.Destroy(t, terraformOptions)
+			k8s.WaitUntilNumPodsCreated(t, kubectlOptions, metav1.ListOptions{
+				LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+			}, 0, 20, 5*time.Second)
+			ValidateNoCollateralDeletions(t, before, SnapshotNamespace(t, kubectlOptions))
+		})
+	}
+}
+
+func TestDelegateMissingNamespaceWithoutCreate(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := strings.ToLower(random.UniqueId())
+	delegateName := fmt.Sprintf("test-delegate-%s", uniqueID)
+	namespaceName := fmt.Sprintf("harness-delegate-missing-%s", uniqueID)
+
+	vars := DefaultTerraformVars(namespaceName, delegateName)
+	vars["create_namespace"] = false
+	terraformOptions := &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	}
+	kubectlOptions := DefaultClusterTarget().KubectlOptions(namespaceName)
+
+	// Point the helm provider at the helpers' cluster
+	DefaultClusterTarget().ConfigureTerraform(t, terraformOptions, kubectlOptions)
+
+	// Clean up resources after test
+	defer terraform.Destroy(t, terraformOptions)
+
+	// Apply must fail cleanly, naming the missing namespace
+	_, err := terraform.InitAndApplyE(t, terraformOptions)
+	require.Error(t, err, "Apply should fail when the namespace does not exist")
+	assert.Contains(t, err.Error(), namespaceName)
+	assert.Contains(t, err.Error(), "not found")
+
+	// Nothing may be left behind: no namespace and no release in the state
+	assert.False(t, SnapshotNamespace(t, kubectlOptions).Exists, "Namespace %s should not be created", namespaceName)
+	state, err := terraform.RunTerraformCommandAndGetStdoutE(t, terraformOptions, "state", "list")
+	require.NoError(t, err)
+	assert.NotContains(t, state, "helm_release.delegate", "A failed install should not be tracked in the state")
+}
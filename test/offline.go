@@ -0,0 +1,173 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// OfflineEnv, set to 1, makes the run hermetic: providers are installed from the mirror only, and
+// helpers that would download a chart fail instead
+const OfflineEnv = "OFFLINE"
+
+// PluginCacheEnv is a plugin cache directory shared by every init of the run
+const PluginCacheEnv = "PLUGIN_CACHE_DIR"
+
+// Offline reports whether OFFLINE is set
+func Offline() bool {
+	switch strings.ToLower(os.Getenv(OfflineEnv)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// RefuseNetwork fails the test in offline mode, before a helper downloads what from the network
+func RefuseNetwork(t *testing.T, what string) {
+	if Offline() {
+		t.Fatalf("%s=1 refuses to download %s", OfflineEnv, what)
+	}
+}
+
+// ProviderInstallation is where Terraform installs providers from
+type ProviderInstallation struct {
+	// MirrorDir is a filesystem mirror, as written by `terraform providers mirror`
+	MirrorDir string
+	// PluginCacheDir keeps the providers installed by an init for the next ones
+	PluginCacheDir string
+	// Offline drops direct installation from the registries, so only the mirror is used
+	Offline bool
+}
+
+// WriteCLIConfig writes a CLI configuration for the installation. Pass the path as
+// TF_CLI_CONFIG_FILE.
+func WriteCLIConfig(path string, installation ProviderInstallation) error {
+	var content strings.Builder
+	if installation.PluginCacheDir != "" {
+		fmt.Fprintf(&content, "plugin_cache_dir = %q\n\n", installation.PluginCacheDir)
+	}
+	if installation.MirrorDir != "" || installation.Offline {
+		content.WriteString("provider_installation {\n")
+		if installation.MirrorDir != "" {
+			fmt.Fprintf(&content, "  filesystem_mirror {\n    path = %q\n  }\n", installation.MirrorDir)
+		}
+		if !installation.Offline {
+			content.WriteString("  direct {}\n")
+		}
+		content.WriteString("}\n")
+	}
+	return os.WriteFile(path, []byte(content.String()), 0644)
+}
+
+// ProviderInstallationFromEnv returns the installation set with PROVIDER_MIRROR_DIR,
+// PLUGIN_CACHE_DIR and OFFLINE, with absolute paths
+func ProviderInstallationFromEnv() (ProviderInstallation, error) {
+	installation := ProviderInstallation{Offline: Offline()}
+	for env, dir := range map[string]*string{ProviderMirrorEnv: &installation.MirrorDir, PluginCacheEnv: &installation.PluginCacheDir} {
+		if value := os.Getenv(env); value != "" {
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return installation, err
+			}
+			*dir = abs
+		}
+	}
+	if installation.Offline && installation.MirrorDir == "" {
+		return installation, fmt.Errorf("%s=1 needs a provider mirror in %s", OfflineEnv, ProviderMirrorEnv)
+	}
+	return installation, nil
+}
+
+// InstallProviderConfig points every Terraform run at the mirror and plugin cache from the
+// environment, through a generated TF_CLI_CONFIG_FILE. Offline, it also turns off the update
+// check. The returned function removes the configuration.
+func InstallProviderConfig() (func(), error) {
+	installation, err := ProviderInstallationFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if installation == (ProviderInstallation{}) {
+		return func() {}, nil
+	}
+	if installation.PluginCacheDir != "" {
+		if err := os.MkdirAll(installation.PluginCacheDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.CreateTemp("", "terraform-*.tfrc")
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	cleanup := func() { os.Remove(file.Name()) }
+	if err := WriteCLIConfig(file.Name(), installation); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	os.Setenv("TF_CLI_CONFIG_FILE", file.Name())
+	if installation.Offline {
+		os.Setenv("CHECKPOINT_DISABLE", "1")
+	}
+	return cleanup, nil
+}
+
+// BuildProviderMirrorE writes the providers the module selects, for the given platforms, to
+// mirrorDir with `<binary> providers mirror`. Each helm provider version, if any, is mirrored from
+// a copy of the module pinned to it.
+func BuildProviderMirrorE(moduleDir, mirrorDir, binary string, platforms, helmVersions []string) error {
+	mirrorDir, err := filepath.Abs(mirrorDir)
+	if err != nil {
+		return err
+	}
+	if binary == "" {
+		binary = terraform.DefaultExecutable
+	}
+	args := []string{"providers", "mirror"}
+	for _, platform := range platforms {
+		args = append(args, "-platform="+platform)
+	}
+	args = append(args, mirrorDir)
+
+	// No version: the module's own constraints select the provider versions
+	if len(helmVersions) == 0 {
+		helmVersions = []string{""}
+	}
+	for _, version := range helmVersions {
+		if err := mirrorProviders(moduleDir, binary, args, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorProviders runs `providers mirror` in a copy of the module, pinned to the helm provider
+// version if set
+func mirrorProviders(moduleDir, binary string, args []string, helmVersion string) error {
+	dir, err := files.CopyTerraformFolderToTemp(moduleDir, "provider-mirror")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if helmVersion != "" {
+		if _, err := WriteProviderOverride(dir, "helm", HelmProviderSource, helmVersion); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dir
+	// The mirror is built from the registries, whatever the run's CLI configuration says
+	cmd.Env = append(os.Environ(), "TF_CLI_CONFIG_FILE=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s (helm provider %q): %w\n%s", binary, strings.Join(args, " "), helmVersion, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseCLIConfig returns the top-level attribute names and block types of a CLI configuration,
+// and the block types inside provider_installation
+func parseCLIConfig(t *testing.T, path string) (attributes []string, methods []string) {
+	file, diags := hclparse.NewParser().ParseHCLFile(path)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "plugin_cache_dir"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "provider_installation"}},
+	})
+	require.False(t, diags.HasErrors(), diags.Error())
+	for name := range content.Attributes {
+		attributes = append(attributes, name)
+	}
+	for _, block := range content.Blocks {
+		installation, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+			Blocks: []hcl.BlockHeaderSchema{{Type: "filesystem_mirror"}, {Type: "direct"}},
+		})
+		require.False(t, diags.HasErrors(), diags.Error())
+		for _, method := range installation.Blocks {
+			methods = append(methods, method.Type)
+		}
+	}
+	return attributes, methods
+}
+
+func TestWriteCLIConfig(t *testing.T) {
+	testCases := []struct {
+		name         string
+		installation ProviderInstallation
+		attributes   []string
+		methods      []string
+	}{
+		{name: "mirror first", installation: ProviderInstallation{MirrorDir: "/srv/mirror", PluginCacheDir: "/srv/cache"}, attributes: []string{"plugin_cache_dir"}, methods: []string{"filesystem_mirror", "direct"}},
+		{name: "offline", installation: ProviderInstallation{MirrorDir: "/srv/mirror", Offline: true}, methods: []string{"filesystem_mirror"}},
+		{name: "cache only", installation: ProviderInstallation{PluginCacheDir: "/srv/cache"}, attributes: []string{"plugin_cache_dir"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cli.tfrc")
+			require.NoError(t, WriteCLIConfig(path, tc.installation))
+			attributes, methods := parseCLIConfig(t, path)
+			assert.Equal(t, tc.attributes, attributes)
+			assert.Equal(t, tc.methods, methods)
+		})
+	}
+}
+
+func TestProviderInstallationFromEnv(t *testing.T) {
+	t.Setenv(ProviderMirrorEnv, "")
+	t.Setenv(PluginCacheEnv, "")
+	t.Setenv(OfflineEnv, "1")
+
+	_, err := ProviderInstallationFromEnv()
+	assert.Error(t, err, "Offline mode should need a mirror")
+
+	t.Setenv(ProviderMirrorEnv, "mirror")
+	t.Setenv(PluginCacheEnv, "/srv/cache")
+	installation, err := ProviderInstallationFromEnv()
+	require.NoError(t, err)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, ProviderInstallation{MirrorDir: filepath.Join(wd, "mirror"), PluginCacheDir: "/srv/cache", Offline: true}, installation)
+
+	t.Setenv(OfflineEnv, "0")
+	installation, err = ProviderInstallationFromEnv()
+	require.NoError(t, err)
+	assert.False(t, installation.Offline)
+}
+
+func TestOfflineInitFromMirror(t *testing.T) {
+	// Use the run's mirror, or build one for this platform
+	mirror := os.Getenv(ProviderMirrorEnv)
+	if mirror == "" {
+		RefuseNetwork(t, "providers to build a mirror")
+		mirror = t.TempDir()
+		require.NoError(t, BuildProviderMirrorE(ModuleDir, mirror, "", []string{runtime.GOOS + "_" + runtime.GOARCH}, nil))
+	}
+
+	initWith := func(mirror string) error {
+		cliConfig := filepath.Join(t.TempDir(), "offline.tfrc")
+		require.NoError(t, WriteCLIConfig(cliConfig, ProviderInstallation{MirrorDir: mirror, Offline: true}))
+		_, err := terraform.InitE(t, &terraform.Options{
+			TerraformDir: CopyModuleDir(t),
+			EnvVars: map[string]string{
+				"TF_CLI_CONFIG_FILE":  cliConfig,
+				"TF_PLUGIN_CACHE_DIR": "",
+				"CHECKPOINT_DISABLE":  "1",
+				// Any network access goes to a closed port and fails
+				"HTTPS_PROXY": "http://127.0.0.1:9",
+				"HTTP_PROXY":  "http://127.0.0.1:9",
+				"NO_PROXY":    "",
+			},
+		})
+		return err
+	}
+
+	require.NoError(t, initWith(mirror), "Init should succeed with only the mirror")
+
+	err := initWith(t.TempDir())
+	require.Error(t, err, "Init should fail with an empty mirror")
+	assert.Contains(t, err.Error(), "hashicorp/helm")
+}
@@ -0,0 +1,269 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodSecurityLevel is a Pod Security Standards profile
+type PodSecurityLevel string
+
+const (
+	PodSecurityPrivileged PodSecurityLevel = "privileged"
+	PodSecurityBaseline   PodSecurityLevel = "baseline"
+	PodSecurityRestricted PodSecurityLevel = "restricted"
+)
+
+// PodSecurityFinding is a single Pod Security Standards violation
+type PodSecurityFinding struct {
+	// Level is the lowest profile that forbids this field value
+	Level PodSecurityLevel
+	// Container is empty for pod-level fields
+	Container string
+	Field     string
+	Message   string
+}
+
+// PodSecurityReport holds every violation found for one workload
+type PodSecurityReport struct {
+	Workload string
+	Findings []PodSecurityFinding
+}
+
+// Satisfies reports whether the workload would be admitted under the given profile
+func (r PodSecurityReport) Satisfies(level PodSecurityLevel) bool {
+	for _, finding := range r.Findings {
+		if finding.Level == PodSecurityBaseline && level != PodSecurityPrivileged {
+			return false
+		}
+		if finding.Level == PodSecurityRestricted && level == PodSecurityRestricted {
+			return false
+		}
+	}
+	return true
+}
+
+// HighestLevel returns the strictest profile the workload satisfies
+func (r PodSecurityReport) HighestLevel() PodSecurityLevel {
+	if r.Satisfies(PodSecurityRestricted) {
+		return PodSecurityRestricted
+	}
+	if r.Satisfies(PodSecurityBaseline) {
+		return PodSecurityBaseline
+	}
+	return PodSecurityPrivileged
+}
+
+// String renders the report with one line per offending field
+func (r PodSecurityReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", r.Workload, r.HighestLevel())
+	for _, finding := range r.Findings {
+		fmt.Fprintf(&b, "  [%s] %s: %s\n", finding.Level, finding.Field, finding.Message)
+	}
+	return b.String()
+}
+
+var (
+	// baselineCapabilities may be added by containers under the baseline profile
+	baselineCapabilities = map[corev1.Capability]bool{
+		"AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true, "FSETID": true,
+		"KILL": true, "MKNOD": true, "NET_BIND_SERVICE": true, "SETFCAP": true, "SETGID": true,
+		"SETPCAP": true, "SETUID": true, "SYS_CHROOT": true,
+	}
+
+	// safeSysctls may be set under the baseline profile
+	safeSysctls = map[string]bool{
+		"kernel.shm_rmid_forced": true, "net.ipv4.ip_local_port_range": true, "net.ipv4.ip_unprivileged_port_start": true,
+		"net.ipv4.tcp_syncookies": true, "net.ipv4.ping_group_range": true, "net.ipv4.ip_local_reserved_ports": true,
+		"net.ipv4.tcp_keepalive_time": true, "net.ipv4.tcp_fin_timeout": true, "net.ipv4.tcp_keepalive_intvl": true,
+		"net.ipv4.tcp_keepalive_probes": true,
+	}
+
+	// baselineSELinuxTypes may be set under the baseline profile
+	baselineSELinuxTypes = map[string]bool{
+		"": true, "container_t": true, "container_init_t": true, "container_kvm_t": true,
+	}
+)
+
+// EvaluatePodSecurity checks a pod template against the baseline and restricted Pod Security Standards
+func EvaluatePodSecurity(workload WorkloadPodSpec) PodSecurityReport {
+	report := PodSecurityReport{Workload: workload.String()}
+	spec := workload.Template.Spec
+	podContext := spec.SecurityContext
+	if podContext == nil {
+		podContext = &corev1.PodSecurityContext{}
+	}
+
+	add := func(level PodSecurityLevel, container, field, format string, args ...interface{}) {
+		report.Findings = append(report.Findings, PodSecurityFinding{
+			Level:     level,
+			Container: container,
+			Field:     field,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Host namespaces
+	if spec.HostNetwork {
+		add(PodSecurityBaseline, "", "spec.hostNetwork", "must not be true")
+	}
+	if spec.HostPID {
+		add(PodSecurityBaseline, "", "spec.hostPID", "must not be true")
+	}
+	if spec.HostIPC {
+		add(PodSecurityBaseline, "", "spec.hostIPC", "must not be true")
+	}
+
+	// Volumes
+	for _, volume := range spec.Volumes {
+		field := fmt.Sprintf("spec.volumes[%s]", volume.Name)
+		if volume.HostPath != nil {
+			add(PodSecurityBaseline, "", field+".hostPath", "hostPath volumes are forbidden")
+			continue
+		}
+		if !isRestrictedVolume(volume) {
+			add(PodSecurityRestricted, "", field, "volume type is not allowed")
+		}
+	}
+
+	// Pod-level security context
+	if podContext.SELinuxOptions != nil {
+		checkSELinux(podContext.SELinuxOptions, "", "spec.securityContext.seLinuxOptions", add)
+	}
+	if podContext.SeccompProfile != nil && podContext.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		add(PodSecurityBaseline, "", "spec.securityContext.seccompProfile.type", "must not be Unconfined")
+	}
+	if podContext.RunAsUser != nil && *podContext.RunAsUser == 0 {
+		add(PodSecurityRestricted, "", "spec.securityContext.runAsUser", "must not be 0")
+	}
+	for _, sysctl := range podContext.Sysctls {
+		if !safeSysctls[sysctl.Name] {
+			add(PodSecurityBaseline, "", "spec.securityContext.sysctls", "sysctl %s is not allowed", sysctl.Name)
+		}
+	}
+
+	// Containers, including init and ephemeral containers
+	containers := append([]corev1.Container{}, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, ephemeral := range spec.EphemeralContainers {
+		containers = append(containers, corev1.Container(ephemeral.EphemeralContainerCommon))
+	}
+
+	for _, container := range containers {
+		prefix := fmt.Sprintf("spec.containers[%s]", container.Name)
+		sc := container.SecurityContext
+		if sc == nil {
+			sc = &corev1.SecurityContext{}
+		}
+
+		for _, port := range container.Ports {
+			if port.HostPort != 0 {
+				add(PodSecurityBaseline, container.Name, prefix+".ports.hostPort", "host port %d is forbidden", port.HostPort)
+			}
+		}
+
+		if sc.Privileged != nil && *sc.Privileged {
+			add(PodSecurityBaseline, container.Name, prefix+".securityContext.privileged", "must not be true")
+		}
+		if sc.ProcMount != nil && *sc.ProcMount != corev1.DefaultProcMount {
+			add(PodSecurityBaseline, container.Name, prefix+".securityContext.procMount", "must be Default")
+		}
+		if sc.SELinuxOptions != nil {
+			checkSELinux(sc.SELinuxOptions, container.Name, prefix+".securityContext.seLinuxOptions", add)
+		}
+
+		annotation := "container.apparmor.security.beta.kubernetes.io/" + container.Name
+		if profile, ok := workload.Template.Annotations[annotation]; ok && profile != "runtime/default" && !strings.HasPrefix(profile, "localhost/") {
+			add(PodSecurityBaseline, container.Name, "metadata.annotations["+annotation+"]", "AppArmor profile %q is not allowed", profile)
+		}
+
+		// Capabilities
+		dropsAll := false
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Add {
+				if !baselineCapabilities[capability] {
+					add(PodSecurityBaseline, container.Name, prefix+".securityContext.capabilities.add", "capability %s is not allowed", capability)
+				} else if capability != "NET_BIND_SERVICE" {
+					add(PodSecurityRestricted, container.Name, prefix+".securityContext.capabilities.add", "only NET_BIND_SERVICE may be added, got %s", capability)
+				}
+			}
+			for _, capability := range sc.Capabilities.Drop {
+				if capability == "ALL" {
+					dropsAll = true
+				}
+			}
+		}
+		if !dropsAll {
+			add(PodSecurityRestricted, container.Name, prefix+".securityContext.capabilities.drop", "must include ALL")
+		}
+
+		// Seccomp: the container setting overrides the pod setting
+		seccomp := podContext.SeccompProfile
+		if sc.SeccompProfile != nil {
+			seccomp = sc.SeccompProfile
+			if seccomp.Type == corev1.SeccompProfileTypeUnconfined {
+				add(PodSecurityBaseline, container.Name, prefix+".securityContext.seccompProfile.type", "must not be Unconfined")
+			}
+		}
+		if seccomp == nil || (seccomp.Type != corev1.SeccompProfileTypeRuntimeDefault && seccomp.Type != corev1.SeccompProfileTypeLocalhost) {
+			add(PodSecurityRestricted, container.Name, prefix+".securityContext.seccompProfile.type", "must be RuntimeDefault or Localhost")
+		}
+
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			add(PodSecurityRestricted, container.Name, prefix+".securityContext.allowPrivilegeEscalation", "must be false")
+		}
+
+		// runAsNonRoot: the container setting overrides the pod setting
+		runAsNonRoot := podContext.RunAsNonRoot
+		if sc.RunAsNonRoot != nil {
+			runAsNonRoot = sc.RunAsNonRoot
+		}
+		if runAsNonRoot == nil || !*runAsNonRoot {
+			add(PodSecurityRestricted, container.Name, prefix+".securityContext.runAsNonRoot", "must be true")
+		}
+		if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			add(PodSecurityRestricted, container.Name, prefix+".securityContext.runAsUser", "must not be 0")
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Field < report.Findings[j].Field
+	})
+
+	return report
+}
+
+// ValidatePodSecurityLevel fails the test if any workload would be rejected under the given profile
+func ValidatePodSecurityLevel(t *testing.T, workloads []WorkloadPodSpec, level PodSecurityLevel) {
+	require.NotEmpty(t, workloads, "There should be at least one workload to evaluate")
+
+	for _, workload := range workloads {
+		report := EvaluatePodSecurity(workload)
+		t.Log(report.String())
+		require.True(t, report.Satisfies(level), "%s should satisfy the %s Pod Security Standard:\n%s", workload, level, report)
+	}
+}
+
+func isRestrictedVolume(volume corev1.Volume) bool {
+	source := volume.VolumeSource
+	return source.ConfigMap != nil || source.CSI != nil || source.DownwardAPI != nil || source.EmptyDir != nil ||
+		source.Ephemeral != nil || source.PersistentVolumeClaim != nil || source.Projected != nil || source.Secret != nil
+}
+
+func checkSELinux(options *corev1.SELinuxOptions, container, field string, add func(PodSecurityLevel, string, string, string, ...interface{})) {
+	if !baselineSELinuxTypes[options.Type] {
+		add(PodSecurityBaseline, container, field+".type", "SELinux type %q is not allowed", options.Type)
+	}
+	if options.User != "" {
+		add(PodSecurityBaseline, container, field+".user", "must not be set")
+	}
+	if options.Role != "" {
+		add(PodSecurityBaseline, container, field+".role", "must not be set")
+	}
+}
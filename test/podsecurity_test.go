@@ -0,0 +1,203 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvaluatePodSecurity(t *testing.T) {
+	falseValue := false
+	trueValue := true
+	nonRootUser := int64(1001)
+
+	restrictedContainer := corev1.Container{
+		Name: "delegate",
+		SecurityContext: &corev1.SecurityContext{
+			RunAsNonRoot:             &trueValue,
+			RunAsUser:                &nonRootUser,
+			AllowPrivilegeEscalation: &falseValue,
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		},
+	}
+
+	privilegedContainer := restrictedContainer
+	privilegedContainer.SecurityContext = &corev1.SecurityContext{Privileged: &trueValue}
+
+	testCases := []struct {
+		name     string
+		spec     corev1.PodSpec
+		expected PodSecurityLevel
+		fields   []string
+	}{
+		{
+			name:     "restricted",
+			spec:     corev1.PodSpec{Containers: []corev1.Container{restrictedContainer}},
+			expected: PodSecurityRestricted,
+		},
+		{
+			name:     "root without security context",
+			spec:     corev1.PodSpec{Containers: []corev1.Container{{Name: "delegate"}}},
+			expected: PodSecurityBaseline,
+			fields: []string{
+				"spec.containers[delegate].securityContext.allowPrivilegeEscalation",
+				"spec.containers[delegate].securityContext.capabilities.drop",
+				"spec.containers[delegate].securityContext.runAsNonRoot",
+				"spec.containers[delegate].securityContext.seccompProfile.type",
+			},
+		},
+		{
+			name: "pod level seccomp and runAsNonRoot",
+			spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{
+					RunAsNonRoot:   &trueValue,
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				},
+				Containers: []corev1.Container{{
+					Name: "delegate",
+					SecurityContext: &corev1.SecurityContext{
+						AllowPrivilegeEscalation: &falseValue,
+						Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+					},
+				}},
+			},
+			expected: PodSecurityRestricted,
+		},
+		{
+			name: "privileged with hostPath",
+			spec: corev1.PodSpec{
+				Containers: []corev1.Container{privilegedContainer},
+				Volumes: []corev1.Volume{{
+					Name:         "docker",
+					VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/run/docker.sock"}},
+				}},
+			},
+			expected: PodSecurityPrivileged,
+			fields: []string{
+				"spec.containers[delegate].securityContext.allowPrivilegeEscalation",
+				"spec.containers[delegate].securityContext.capabilities.drop",
+				"spec.containers[delegate].securityContext.privileged",
+				"spec.containers[delegate].securityContext.runAsNonRoot",
+				"spec.containers[delegate].securityContext.seccompProfile.type",
+				"spec.volumes[docker].hostPath",
+			},
+		},
+		{
+			name: "added capability",
+			spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "delegate",
+				SecurityContext: &corev1.SecurityContext{
+					RunAsNonRoot:             &trueValue,
+					AllowPrivilegeEscalation: &falseValue,
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"SYS_ADMIN"}},
+					SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				},
+			}}},
+			expected: PodSecurityPrivileged,
+			fields:   []string{"spec.containers[delegate].securityContext.capabilities.add"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			report := EvaluatePodSecurity(WorkloadPodSpec{
+				Kind:     "Deployment",
+				Name:     "test-delegate",
+				Template: corev1.PodTemplateSpec{Spec: tc.spec},
+			})
+
+			assert.Equal(t, tc.expected, report.HighestLevel(), report.String())
+
+			var fields []string
+			for _, finding := range report.Findings {
+				fields = append(fields, finding.Field)
+			}
+			assert.Equal(t, tc.fields, fields)
+		})
+	}
+}
+
+func TestRenderedDelegatePodSecurity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		overlay  string
+		expected PodSecurityLevel
+	}{
+		{name: "default", expected: PodSecurityBaseline},
+		{name: "restricted overlay", overlay: "pss-restricted.yaml", expected: PodSecurityRestricted},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+			vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+			vars["upgrader_enabled"] = true
+			if tc.overlay != "" {
+				vars["values"] = LoadValuesOverlay(t, tc.overlay)
+			}
+
+			workloads := RenderedWorkloads(t, &terraform.Options{
+				TerraformDir: CopyModuleDir(t),
+				Vars:         vars,
+			})
+
+			delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+			upgrader := FindWorkload(t, workloads, "CronJob", fmt.Sprintf("%s-upgrader-job", delegateName))
+
+			ValidatePodSecurityLevel(t, []WorkloadPodSpec{delegate, upgrader}, tc.expected)
+		})
+	}
+}
+
+func TestDelegateInRestrictedNamespace(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := strings.ToLower(random.UniqueId())
+	delegateName := fmt.Sprintf("test-delegate-%s", uniqueID)
+	replicas := 1
+
+	// Create a namespace that enforces the restricted Pod Security Standard
+	testNamespace := AllocateNamespaceWithLabels(t, "harness-delegate-pss", map[string]string{
+		"pod-security.kubernetes.io/enforce": string(PodSecurityRestricted),
+	})
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Setup the terraform options with the restricted overlay
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas":         replicas,
+		"upgrader_enabled": true,
+		"values":           LoadValuesOverlay(t, "pss-restricted.yaml"),
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Pods are only admitted if they satisfy the namespace policy
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Evaluate the released manifest
+	objects, err := ParseManifest(GetReleaseManifest(t, kubectlOptions, delegateName))
+	require.NoError(t, err)
+	workloads, err := PodSpecsFromManifest(objects)
+	require.NoError(t, err)
+	ValidatePodSecurityLevel(t, workloads, PodSecurityRestricted)
+
+	// Evaluate the live pods
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	assert.Equal(t, replicas, len(pods), "expected number of pods")
+	ValidatePodSecurityLevel(t, PodSpecsFromPods(pods), PodSecurityRestricted)
+}
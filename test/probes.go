@@ -0,0 +1,179 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ProbePolicy configures the probe inspection
+type ProbePolicy struct {
+	// MinStartupBudget is the minimum time the delegate gets to start before liveness can kill it
+	MinStartupBudget time.Duration
+}
+
+// DefaultProbePolicy gives the delegate JVM two minutes to start
+var DefaultProbePolicy = ProbePolicy{
+	MinStartupBudget: 2 * time.Minute,
+}
+
+// InspectProbes returns every problem found in the liveness, readiness and startup probes of a container
+func InspectProbes(container corev1.Container, policy ProbePolicy) []string {
+	var issues []string
+
+	if container.ReadinessProbe == nil {
+		issues = append(issues, "readiness probe is not defined")
+	}
+	if container.LivenessProbe == nil {
+		issues = append(issues, "liveness probe is not defined")
+	}
+
+	probes := map[string]*corev1.Probe{
+		"liveness":  container.LivenessProbe,
+		"readiness": container.ReadinessProbe,
+		"startup":   container.StartupProbe,
+	}
+	for _, name := range []string{"liveness", "readiness", "startup"} {
+		probe := probes[name]
+		if probe == nil {
+			continue
+		}
+		if probe.Exec == nil && probe.HTTPGet == nil && probe.TCPSocket == nil && probe.GRPC == nil {
+			issues = append(issues, fmt.Sprintf("%s probe has no handler", name))
+		}
+		if port, ok := probePort(probe); ok && port.Type == intstr.String && !hasContainerPort(container, port.StrVal) {
+			issues = append(issues, fmt.Sprintf("%s probe references unknown port %q", name, port.StrVal))
+		}
+		if probe.TimeoutSeconds != 0 && probe.PeriodSeconds != 0 && probe.TimeoutSeconds > probe.PeriodSeconds {
+			issues = append(issues, fmt.Sprintf("%s probe timeout %ds exceeds its period %ds", name, probe.TimeoutSeconds, probe.PeriodSeconds))
+		}
+	}
+
+	// Without a startup probe, liveness alone has to tolerate the JVM start
+	startupProbe := container.StartupProbe
+	startupProbeName := "startup"
+	if startupProbe == nil {
+		startupProbe = container.LivenessProbe
+		startupProbeName = "liveness"
+	}
+	if startupProbe != nil {
+		if budget := probeStartupBudget(startupProbe); budget < policy.MinStartupBudget {
+			issues = append(issues, fmt.Sprintf("%s probe allows %s to start, less than %s", startupProbeName, budget, policy.MinStartupBudget))
+		}
+	}
+
+	return issues
+}
+
+// ValidateProbes fails the test if the container's probes are misconfigured
+func ValidateProbes(t *testing.T, container corev1.Container, policy ProbePolicy) {
+	issues := InspectProbes(container, policy)
+	require.Empty(t, issues, "Container %s should have well-formed probes", container.Name)
+}
+
+// probeStartupBudget is the time before a probe that keeps failing gives up, with the API defaults applied
+func probeStartupBudget(probe *corev1.Probe) time.Duration {
+	period := probe.PeriodSeconds
+	if period == 0 {
+		period = 10
+	}
+	failureThreshold := probe.FailureThreshold
+	if failureThreshold == 0 {
+		failureThreshold = 3
+	}
+	return time.Duration(probe.InitialDelaySeconds+period*failureThreshold) * time.Second
+}
+
+func probePort(probe *corev1.Probe) (intstr.IntOrString, bool) {
+	if probe.HTTPGet != nil {
+		return probe.HTTPGet.Port, true
+	}
+	if probe.TCPSocket != nil {
+		return probe.TCPSocket.Port, true
+	}
+	return intstr.IntOrString{}, false
+}
+
+func hasContainerPort(container corev1.Container, name string) bool {
+	for _, port := range container.Ports {
+		if port.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PodReadinessTiming is the time a pod took to become Ready, derived from its conditions
+type PodReadinessTiming struct {
+	Pod         string        `json:"pod"`
+	Created     time.Time     `json:"created"`
+	Scheduled   time.Time     `json:"scheduled"`
+	Ready       time.Time     `json:"ready"`
+	TimeToReady time.Duration `json:"-"`
+	Seconds     float64       `json:"timeToReadySeconds"`
+	Restarts    int32         `json:"restarts"`
+}
+
+// MeasurePodReadiness returns the readiness timing of every pod. Pods that are not Ready yet have a zero TimeToReady.
+func MeasurePodReadiness(pods []corev1.Pod) []PodReadinessTiming {
+	timings := make([]PodReadinessTiming, 0, len(pods))
+
+	for _, pod := range pods {
+		timing := PodReadinessTiming{
+			Pod:      pod.Name,
+			Created:  pod.CreationTimestamp.Time,
+			Restarts: podRestarts(pod),
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case corev1.PodScheduled:
+				timing.Scheduled = condition.LastTransitionTime.Time
+			case corev1.PodReady:
+				timing.Ready = condition.LastTransitionTime.Time
+			}
+		}
+		if !timing.Ready.IsZero() {
+			timing.TimeToReady = timing.Ready.Sub(timing.Created)
+			timing.Seconds = timing.TimeToReady.Seconds()
+		}
+		timings = append(timings, timing)
+	}
+
+	return timings
+}
+
+// WaitForNoRestarts watches the pods matching the selector until window has elapsed since start,
+// failing as soon as any container restarts. It returns the last readiness timings observed.
+func WaitForNoRestarts(t *testing.T, kubectlOptions *k8s.KubectlOptions, selector string, start time.Time, window, pollInterval time.Duration) []PodReadinessTiming {
+	var timings []PodReadinessTiming
+
+	for {
+		pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{LabelSelector: selector})
+		timings = MeasurePodReadiness(pods)
+		for _, pod := range pods {
+			require.Zero(t, podRestarts(pod), "Pod %s restarted within %s of apply", pod.Name, window)
+		}
+
+		if time.Since(start) >= window {
+			return timings
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func podRestarts(pod corev1.Pod) int32 {
+	var restarts int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+	}
+	return restarts
+}
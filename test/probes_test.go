@@ -0,0 +1,153 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestInspectProbes(t *testing.T) {
+	httpProbe := func(port intstr.IntOrString, initialDelay, period, failureThreshold int32) *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler:        corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/api/health", Port: port}},
+			InitialDelaySeconds: initialDelay,
+			PeriodSeconds:       period,
+			FailureThreshold:    failureThreshold,
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		container corev1.Container
+		issues    int
+	}{
+		{
+			name: "startup probe covers slow start",
+			container: corev1.Container{
+				LivenessProbe:  httpProbe(intstr.FromInt(3460), 0, 10, 3),
+				ReadinessProbe: httpProbe(intstr.FromInt(3460), 0, 10, 3),
+				StartupProbe:   httpProbe(intstr.FromInt(3460), 0, 10, 15),
+			},
+		},
+		{
+			name: "liveness kills the delegate before it starts",
+			container: corev1.Container{
+				LivenessProbe:  httpProbe(intstr.FromInt(3460), 5, 10, 3),
+				ReadinessProbe: httpProbe(intstr.FromInt(3460), 0, 10, 3),
+			},
+			issues: 1,
+		},
+		{
+			name:      "no probes",
+			container: corev1.Container{},
+			issues:    2,
+		},
+		{
+			name: "unknown named port and empty handler",
+			container: corev1.Container{
+				Ports:          []corev1.ContainerPort{{Name: "http", ContainerPort: 3460}},
+				LivenessProbe:  httpProbe(intstr.FromString("health"), 120, 10, 3),
+				ReadinessProbe: &corev1.Probe{},
+			},
+			issues: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issues := InspectProbes(tc.container, DefaultProbePolicy)
+			assert.Len(t, issues, tc.issues, "%v", issues)
+		})
+	}
+}
+
+func TestMeasurePodReadiness(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "delegate-0", CreationTimestamp: metav1.NewTime(created)},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(created.Add(2 * time.Second))},
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(created.Add(95 * time.Second))},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{{RestartCount: 1}},
+		},
+	}
+	pending := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "delegate-1", CreationTimestamp: metav1.NewTime(created)}}
+
+	timings := MeasurePodReadiness([]corev1.Pod{pod, pending})
+	require.Len(t, timings, 2)
+	assert.Equal(t, 95*time.Second, timings[0].TimeToReady)
+	assert.Equal(t, 95.0, timings[0].Seconds)
+	assert.Equal(t, int32(1), timings[0].Restarts)
+	assert.Zero(t, timings[1].TimeToReady)
+}
+
+func TestRenderedDelegateProbes(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+
+	workloads := RenderedWorkloads(t, &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         DefaultTerraformVars("harness-delegate-ng", delegateName),
+	})
+
+	delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+	ValidateProbes(t, delegate.Template.Spec.Containers[0], DefaultProbePolicy)
+}
+
+func TestDelegateReadinessTiming(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	replicas := 1
+
+	// Restarts are watched for this long after apply
+	restartWindow := 3 * time.Minute
+	if value := os.Getenv("RESTART_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		require.NoError(t, err, "RESTART_WINDOW should be a duration")
+		restartWindow = window
+	}
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas": replicas,
+	})
+
+	// Run terraform init and apply
+	applyStart := time.Now()
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Get the Kubernetes config path
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Inspect the probes of the live container
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	ValidateProbes(t, deployment.Spec.Template.Spec.Containers[0], DefaultProbePolicy)
+
+	// Watch for restarts and record the time to ready of every pod
+	labelSelector := metav1.FormatLabelSelector(deployment.Spec.Selector)
+	timings := WaitForNoRestarts(t, kubectlOptions, labelSelector, applyStart, restartWindow, 15*time.Second)
+	require.Len(t, timings, replicas, "expected number of pods")
+	for _, timing := range timings {
+		assert.NotZero(t, timing.TimeToReady, "Pod %s should be Ready", timing.Pod)
+	}
+
+	WriteJSONReport(t, "readiness", timings)
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+)
+
+// HelmProviderVersionEnv pins the helm provider version of the run, through an override file in a
+// staged copy of the module. It is set per version by the matrix runner in cmd/providermatrix.
+const HelmProviderVersionEnv = "HELM_PROVIDER_VERSION"
+
+// HelmProviderVersionsEnv lists the helm provider versions of the matrix, comma-separated
+const HelmProviderVersionsEnv = "HELM_PROVIDER_VERSIONS"
+
+// ProviderMirrorEnv is a filesystem provider mirror, as written by `terraform providers mirror`,
+// that providers are installed from before the registries, or only from when OFFLINE is set
+const ProviderMirrorEnv = "PROVIDER_MIRROR_DIR"
+
+// HelmProviderSource is the helm provider's source address
+const HelmProviderSource = "hashicorp/helm"
+
+// helmProviderAddresses are the helm provider's addresses in the Terraform and OpenTofu registries
+var helmProviderAddresses = []string{"registry.terraform.io/hashicorp/helm", "registry.opentofu.org/hashicorp/helm"}
+
+// ModuleDir is the module under test. Tests copy it with CopyModuleDir rather than running
+// Terraform in it, which would leave .terraform and a lock file in the checkout.
+var ModuleDir = "../"
+
+// WriteProviderOverride writes an override file to moduleDir pinning the provider to version.
+// Override files replace the matching required_providers entry of versions.tf.
+func WriteProviderOverride(moduleDir, name, source, version string) (string, error) {
+	path := filepath.Join(moduleDir, name+"_provider_override.tf")
+	content := fmt.Sprintf(`terraform {
+  required_providers {
+    %s = {
+      source  = %q
+      version = "= %s"
+    }
+  }
+}
+`, name, source, version)
+	return path, os.WriteFile(path, []byte(content), 0644)
+}
+
+// packedProviderArchive matches the archives of the packed mirror layout, e.g.
+// terraform-provider-helm_3.0.2_linux_amd64.zip
+var packedProviderArchive = regexp.MustCompile(`^terraform-provider-[^_]+_([^_]+)_[^_]+_[^_]+\.zip$`)
+
+// MirroredProviderVersions returns the versions of a provider, e.g.
+// registry.terraform.io/hashicorp/helm, found in a filesystem mirror, in the packed or the unpacked
+// layout
+func MirroredProviderVersions(mirrorDir, address string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(mirrorDir, filepath.FromSlash(address)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			found[entry.Name()] = true
+		} else if match := packedProviderArchive.FindStringSubmatch(entry.Name()); match != nil {
+			found[match[1]] = true
+		}
+	}
+	versions := make([]string, 0, len(found))
+	for version := range found {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// MirroredHelmProviderVersions returns the helm provider versions found in the mirror under any
+// registry address
+func MirroredHelmProviderVersions(mirrorDir string) ([]string, error) {
+	found := make(map[string]bool)
+	for _, address := range helmProviderAddresses {
+		versions, err := MirroredProviderVersions(mirrorDir, address)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			found[version] = true
+		}
+	}
+	versions := make([]string, 0, len(found))
+	for version := range found {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// InstallHelmProviderVersion stages a copy of the module pinned to HELM_PROVIDER_VERSION and makes
+// it the ModuleDir of the run. The provider comes from PROVIDER_MIRROR_DIR, if set, through
+// InstallProviderConfig. The returned function removes the staged copy.
+func InstallHelmProviderVersion() (func(), error) {
+	version := os.Getenv(HelmProviderVersionEnv)
+	if version == "" {
+		return func() {}, nil
+	}
+
+	dir, err := files.CopyTerraformFolderToTemp(ModuleDir, "helm-provider-"+version)
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	// A lock file left by a run in the checkout would pin another version
+	if err := os.Remove(filepath.Join(dir, ".terraform.lock.hcl")); err != nil && !os.IsNotExist(err) {
+		cleanup()
+		return nil, err
+	}
+	if _, err := WriteProviderOverride(dir, "helm", HelmProviderSource, version); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	ModuleDir = dir
+	return cleanup, nil
+}
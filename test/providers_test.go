@@ -0,0 +1,55 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirroredProviderVersions(t *testing.T) {
+	mirror := t.TempDir()
+	// Unpacked layout under the Terraform registry, packed layout under the OpenTofu one
+	require.NoError(t, os.MkdirAll(filepath.Join(mirror, "registry.terraform.io/hashicorp/helm/2.17.0/linux_amd64"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(mirror, "registry.opentofu.org/hashicorp/helm"), 0755))
+	for _, name := range []string{"terraform-provider-helm_3.0.2_linux_amd64.zip", "terraform-provider-helm_3.0.2_darwin_arm64.zip", "index.json", "3.0.2.json"} {
+		require.NoError(t, os.WriteFile(filepath.Join(mirror, "registry.opentofu.org/hashicorp/helm", name), nil, 0644))
+	}
+
+	versions, err := MirroredProviderVersions(mirror, "registry.opentofu.org/hashicorp/helm")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3.0.2"}, versions)
+
+	versions, err = MirroredHelmProviderVersions(mirror)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2.17.0", "3.0.2"}, versions)
+
+	versions, err = MirroredProviderVersions(mirror, "registry.terraform.io/cloudposse/utils")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestInstallHelmProviderVersion(t *testing.T) {
+	t.Setenv(HelmProviderVersionEnv, "3.0.2")
+	defer func(dir string) { ModuleDir = dir }(ModuleDir)
+
+	cleanup, err := InstallHelmProviderVersion()
+	require.NoError(t, err)
+	staged := ModuleDir
+	assert.NotEqual(t, "../", staged)
+	assert.FileExists(t, filepath.Join(staged, "main.tf"))
+
+	// The override must be valid HCL pinning the version
+	override, err := os.ReadFile(filepath.Join(staged, "helm_provider_override.tf"))
+	require.NoError(t, err)
+	_, diags := hclparse.NewParser().ParseHCL(override, "helm_provider_override.tf")
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Contains(t, string(override), `version = "= 3.0.2"`)
+	assert.Contains(t, string(override), `source  = "hashicorp/helm"`)
+
+	cleanup()
+	assert.NoDirExists(t, staged)
+}
@@ -10,24 +10,20 @@ import (
 	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
-	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestDelegateWithProxyConfiguration(t *testing.T) {
-	// Load environment variables from .env file
-	_ = godotenv.Load(".env")
+	t.Parallel()
 
 	// Get unique resource names for parallel testing
 	uniqueID := random.UniqueId()
 	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
-	namespaceName := "harness-delegate-ng"
-	account_id := os.Getenv("ACCOUNT_ID")
-	delegate_token := os.Getenv("DELEGATE_TOKEN")
-	delegate_image := os.Getenv("DELEGATE_IMAGE")
-	manager_endpoint := os.Getenv("MANAGER_ENDPOINT")
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	namespaceName := testNamespace.Name
+	env := LoadLiveDelegateEnv()
 	replicas := 1
 	proxy_host := os.Getenv("PROXY_HOST")
 	proxy_port := os.Getenv("PROXY_PORT")
@@ -37,36 +33,22 @@ func TestDelegateWithProxyConfiguration(t *testing.T) {
 	no_proxy := os.Getenv("NO_PROXY")
 
 	// Setup the terraform options with proxy configuration
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
-		TerraformDir: "../",
-		Vars: map[string]interface{}{
-			"namespace":        namespaceName,
-			"delegate_name":    delegateName,
-			"account_id":       account_id,
-			"delegate_token":   delegate_token,
-			"delegate_image":   delegate_image,
-			"manager_endpoint": manager_endpoint,
-			"replicas":         replicas,
-			"upgrader_enabled": false,
-			"create_namespace": true,
-			// Proxy configuration
-			"proxy_host":     proxy_host,
-			"proxy_port":     proxy_port,
-			"proxy_scheme":   proxy_scheme,
-			"proxy_user":     proxy_user,
-			"proxy_password": proxy_password,
-			"no_proxy":       no_proxy,
-		},
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas": replicas,
+		// Proxy configuration
+		"proxy_host":     proxy_host,
+		"proxy_port":     proxy_port,
+		"proxy_scheme":   proxy_scheme,
+		"proxy_user":     proxy_user,
+		"proxy_password": proxy_password,
+		"no_proxy":       no_proxy,
 	})
 
-	// Clean up resources after test
-	defer terraform.Destroy(t, terraformOptions)
-
 	// Run terraform init and apply
 	terraform.InitAndApply(t, terraformOptions)
 
 	// Get the Kubernetes config path
-	kubectlOptions := k8s.NewKubectlOptions("", "", namespaceName)
+	kubectlOptions := testNamespace.KubectlOptions
 
 	// Verify the namespace exists
 	namespace := k8s.GetNamespace(t, kubectlOptions, namespaceName)
@@ -97,7 +79,7 @@ func TestDelegateWithProxyConfiguration(t *testing.T) {
 	envMap := ResolveContainerEnvMap(t, kubectlOptions, container)
 
 	// Validate basic delegate configuration
-	ValidateBasicDelegateConfiguration(t, envMap, account_id, manager_endpoint, delegateName, &container, delegate_image)
+	ValidateBasicDelegateConfiguration(t, envMap, env.AccountID, env.ManagerEndpoint, delegateName, &container, env.DelegateImage)
 
 	// Validate proxy configuration
 	proxyConfig := ProxyConfig{
@@ -131,50 +113,33 @@ func TestDelegateWithProxyConfiguration(t *testing.T) {
 }
 
 func TestDelegateWithoutProxyConfiguration(t *testing.T) {
-	// Load environment variables from .env file
-	_ = godotenv.Load(".env")
+	t.Parallel()
 
 	// Get unique resource names for parallel testing
 	uniqueID := random.UniqueId()
 	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
-	namespaceName := "harness-delegate-ng"
-	account_id := os.Getenv("ACCOUNT_ID")
-	delegate_token := os.Getenv("DELEGATE_TOKEN")
-	delegate_image := os.Getenv("DELEGATE_IMAGE")
-	manager_endpoint := os.Getenv("MANAGER_ENDPOINT")
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	namespaceName := testNamespace.Name
+	env := LoadLiveDelegateEnv()
 	replicas := 1
 
 	// Setup the terraform options without proxy configuration
-	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
-		TerraformDir: "../",
-		Vars: map[string]interface{}{
-			"namespace":        namespaceName,
-			"delegate_name":    delegateName,
-			"account_id":       account_id,
-			"delegate_token":   delegate_token,
-			"delegate_image":   delegate_image,
-			"manager_endpoint": manager_endpoint,
-			"replicas":         replicas,
-			"upgrader_enabled": false,
-			"create_namespace": true,
-			// Explicitly empty proxy configuration
-			"proxy_host":     "",
-			"proxy_port":     "",
-			"proxy_scheme":   "",
-			"proxy_user":     "",
-			"proxy_password": "",
-			"no_proxy":       "",
-		},
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas": replicas,
+		// Explicitly empty proxy configuration
+		"proxy_host":     "",
+		"proxy_port":     "",
+		"proxy_scheme":   "",
+		"proxy_user":     "",
+		"proxy_password": "",
+		"no_proxy":       "",
 	})
 
-	// Clean up resources after test
-	defer terraform.Destroy(t, terraformOptions)
-
 	// Run terraform init and apply
 	terraform.InitAndApply(t, terraformOptions)
 
 	// Get the Kubernetes config path
-	kubectlOptions := k8s.NewKubectlOptions("", "", namespaceName)
+	kubectlOptions := testNamespace.KubectlOptions
 
 	// Verify the namespace exists
 	namespace := k8s.GetNamespace(t, kubectlOptions, namespaceName)
@@ -205,7 +170,7 @@ func TestDelegateWithoutProxyConfiguration(t *testing.T) {
 	envMap := ResolveContainerEnvMap(t, kubectlOptions, container)
 
 	// Validate basic delegate configuration
-	ValidateBasicDelegateConfiguration(t, envMap, account_id, manager_endpoint, delegateName, &container, delegate_image)
+	ValidateBasicDelegateConfiguration(t, envMap, env.AccountID, env.ManagerEndpoint, delegateName, &container, env.DelegateImage)
 
 	// Validate no proxy configuration
 	ValidateNoProxyConfiguration(t, envMap)
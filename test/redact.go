@@ -0,0 +1,129 @@
+package test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// RedactedPlaceholder replaces secret values in logs
+const RedactedPlaceholder = "[REDACTED]"
+
+// SecretVarNames are the module variables holding secrets. They are passed to Terraform through
+// the environment rather than on the command line, which terratest logs.
+var SecretVarNames = []string{"delegate_token", "proxy_password"}
+
+// SecretEnvNames are the .env entries holding secrets, registered with the Redactor by TestMain
+var SecretEnvNames = []string{"DELEGATE_TOKEN", "DELEGATE_TOKEN_ROTATED", "PROXY_PASSWORD"}
+
+// RedactingLogger is a terratest logger that replaces registered secret values, verbatim or
+// base64 encoded as in Secret manifests, before handing lines to the next logger
+type RedactingLogger struct {
+	next logger.TestLogger
+	// parent, if set, holds the secrets instead
+	parent *RedactingLogger
+
+	mu       sync.RWMutex
+	replacer *strings.Replacer
+	secrets  map[string]bool
+}
+
+// NewRedactingLogger returns a RedactingLogger logging to next
+func NewRedactingLogger(next logger.TestLogger) *RedactingLogger {
+	return &RedactingLogger{next: next, replacer: strings.NewReplacer(), secrets: make(map[string]bool)}
+}
+
+// Redactor redacts every terratest log line once installed as logger.Default by TestMain, which
+// covers Terraform, Helm and kubectl commands run without an explicit Logger
+var Redactor = NewRedactingLogger(logger.Terratest)
+
+// RegisterSecret adds values to redact. Empty values are ignored.
+func (l *RedactingLogger) RegisterSecret(values ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, value := range values {
+		if value != "" {
+			l.secrets[value] = true
+			l.secrets[base64.StdEncoding.EncodeToString([]byte(value))] = true
+		}
+	}
+
+	// Longer secrets first, so that a secret containing another is redacted whole
+	secrets := make([]string, 0, len(l.secrets))
+	for secret := range l.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, RedactedPlaceholder)
+	}
+	l.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact returns s with the registered secrets replaced
+func (l *RedactingLogger) Redact(s string) string {
+	if l.parent != nil {
+		return l.parent.Redact(s)
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.replacer.Replace(s)
+}
+
+// Logf formats the line, redacts it and passes it on
+func (l *RedactingLogger) Logf(t terratesting.TestingT, format string, args ...interface{}) {
+	l.next.Logf(t, "%s", l.Redact(fmt.Sprintf(format, args...)))
+}
+
+// Into returns a terratest logger redacting the same secrets into next, e.g. to capture the
+// logs of a test
+func (l *RedactingLogger) Into(next logger.TestLogger) *logger.Logger {
+	return logger.New(&RedactingLogger{next: next, parent: l})
+}
+
+// MoveSecretVarsToEnv moves the SecretVarNames set in the options' Vars to TF_VAR_* environment
+// variables, so that they never appear in a logged command line, and registers their values
+// with the Redactor
+func MoveSecretVarsToEnv(t *testing.T, terraformOptions *terraform.Options) {
+	for _, name := range SecretVarNames {
+		value, ok := terraformOptions.Vars[name]
+		if !ok {
+			continue
+		}
+		str, isString := value.(string)
+		if !isString {
+			t.Fatalf("Secret variable %s should be a string", name)
+		}
+
+		if terraformOptions.EnvVars == nil {
+			terraformOptions.EnvVars = make(map[string]string)
+		}
+		terraformOptions.EnvVars["TF_VAR_"+name] = str
+		delete(terraformOptions.Vars, name)
+		Redactor.RegisterSecret(str)
+	}
+}
+
+// InstallRedactor makes the Redactor the default terratest logger and registers the secrets
+// found in the SecretEnvNames environment variables
+func InstallRedactor() {
+	for _, name := range SecretEnvNames {
+		Redactor.RegisterSecret(os.Getenv(name))
+	}
+	logger.Default = logger.New(Redactor)
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capturingLogger records every log line, and still prints them
+type capturingLogger struct {
+	mu    sync.Mutex
+	lines strings.Builder
+}
+
+func (c *capturingLogger) Logf(t terratesting.TestingT, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	c.mu.Lock()
+	c.lines.WriteString(line + "\n")
+	c.mu.Unlock()
+	logger.Terratest.Logf(t, "%s", line)
+}
+
+func (c *capturingLogger) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lines.String()
+}
+
+func TestRedactingLogger(t *testing.T) {
+	capture := &capturingLogger{}
+	redactor := NewRedactingLogger(capture)
+	redactor.RegisterSecret("s3cr3t", "s3cr3t-and-more", "")
+
+	redactor.Logf(t, "token=%s", "s3cr3t")
+	redactor.Logf(t, "long=s3cr3t-and-more")
+	redactor.Logf(t, "data: %s", base64.StdEncoding.EncodeToString([]byte("s3cr3t")))
+	redactor.Logf(t, "nothing secret here")
+
+	assert.Equal(t, "token=[REDACTED]\nlong=[REDACTED]\ndata: [REDACTED]\nnothing secret here\n", capture.String())
+}
+
+func TestMoveSecretVarsToEnv(t *testing.T) {
+	token := fmt.Sprintf("token-%s", t.Name())
+	options := &terraform.Options{
+		Vars: map[string]interface{}{
+			"delegate_name":  "delegate",
+			"delegate_token": token,
+			"proxy_password": "proxy-pass",
+		},
+	}
+
+	MoveSecretVarsToEnv(t, options)
+	assert.Equal(t, map[string]interface{}{"delegate_name": "delegate"}, options.Vars)
+	assert.Equal(t, token, options.EnvVars["TF_VAR_delegate_token"])
+	assert.Equal(t, "proxy-pass", options.EnvVars["TF_VAR_proxy_password"])
+
+	args := strings.Join(terraform.FormatArgs(options, "apply", "-input=false"), " ")
+	ValidateSecretsRedacted(t, args, token, "proxy-pass")
+	assert.Equal(t, "token [REDACTED]", Redactor.Redact("token "+token), "The secret should be registered")
+}
+
+func TestRedactedCommandOutput(t *testing.T) {
+	secret := fmt.Sprintf("secret-%s", t.Name())
+	Redactor.RegisterSecret(secret)
+	capture := &capturingLogger{}
+
+	// Commands print the secret verbatim and base64 encoded, as `kubectl get secret -o yaml` does
+	shell.RunCommand(t, shell.Command{
+		Command: "sh",
+		Args:    []string{"-c", `echo "token: $SECRET"; printf %s "$SECRET" | base64`},
+		Env:     map[string]string{"SECRET": secret},
+		Logger:  Redactor.Into(capture),
+	})
+
+	logs := capture.String()
+	ValidateSecretsRedacted(t, logs, secret)
+	assert.Contains(t, logs, "token: [REDACTED]")
+}
+
+func TestRenderedDelegateLogsRedacted(t *testing.T) {
+	token := fmt.Sprintf("token-%s", t.Name())
+	password := fmt.Sprintf("password-%s", t.Name())
+	capture := &capturingLogger{}
+
+	vars := DefaultTerraformVars("harness-delegate-ng", "delegate-redacted")
+	vars["delegate_token"] = token
+	vars["proxy_host"] = "proxy.example.com"
+	vars["proxy_user"] = "user"
+	vars["proxy_password"] = password
+	options := &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+		Logger:       Redactor.Into(capture),
+	}
+	MoveSecretVarsToEnv(t, options)
+
+	// The plan JSON and the rendered manifest both hold the password
+	RenderDelegateManifest(t, options)
+
+	// The binary is terraform or tofu, depending on IAC_BINARY
+	binary := options.TerraformBinary
+	if binary == "" {
+		binary = terraform.DefaultExecutable
+	}
+	logs := capture.String()
+	require.Contains(t, logs, "Running command "+binary, "Terraform output should be captured")
+	ValidateSecretsRedacted(t, logs, token, password)
+	assert.Contains(t, logs, RedactedPlaceholder)
+}
@@ -0,0 +1,52 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestReport is the envelope for machine-readable results written by the tests
+type TestReport struct {
+	Test      string      `json:"test"`
+	Kind      string      `json:"kind"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+var unsafeReportChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ReportDir returns the directory reports are written to, set with TEST_REPORT_DIR
+func ReportDir() string {
+	if dir := os.Getenv("TEST_REPORT_DIR"); dir != "" {
+		return dir
+	}
+	return "reports"
+}
+
+// WriteJSONReport writes data as <ReportDir>/<test>.<kind>.json and returns the file path
+func WriteJSONReport(t *testing.T, kind string, data interface{}) string {
+	report := TestReport{
+		Test:      t.Name(),
+		Kind:      kind,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	require.NoError(t, err)
+
+	dir := ReportDir()
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	path := filepath.Join(dir, unsafeReportChars.ReplaceAllString(t.Name(), "_")+"."+kind+".json")
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	t.Logf("Wrote %s report to %s", kind, path)
+
+	return path
+}
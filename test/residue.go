@@ -0,0 +1,248 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// LiveObject is an object read from the cluster
+type LiveObject struct {
+	Kind      string
+	Namespace string
+	Name      string
+	UID       string
+	// Owners holds the UIDs of the owner references
+	Owners      []string
+	Finalizers  []string
+	Terminating bool
+}
+
+// String returns the object as Kind/name, noting the finalizers holding it if it is terminating
+func (o LiveObject) String() string {
+	if o.Terminating && len(o.Finalizers) > 0 {
+		return fmt.Sprintf("%s/%s (stuck on finalizers %s)", o.Kind, o.Name, strings.Join(o.Finalizers, ", "))
+	}
+	return fmt.Sprintf("%s/%s", o.Kind, o.Name)
+}
+
+// ReleaseInventory records the objects of a Helm release: those of its manifest, their
+// owner-reference descendants (ReplicaSets, Jobs, Pods) and the Helm release records
+type ReleaseInventory struct {
+	Namespace string
+	Release   string
+	Objects   []LiveObject
+}
+
+// residueKinds maps the kinds listed in a single call per namespace to their resources. Other
+// kinds, such as cluster-scoped RBAC objects, are read one by one.
+var residueKinds = map[string]string{
+	"ConfigMap":               "configmaps",
+	"Secret":                  "secrets",
+	"ServiceAccount":          "serviceaccounts",
+	"Service":                 "services",
+	"PersistentVolumeClaim":   "persistentvolumeclaims",
+	"Deployment":              "deployments",
+	"ReplicaSet":              "replicasets",
+	"Pod":                     "pods",
+	"CronJob":                 "cronjobs",
+	"Job":                     "jobs",
+	"Role":                    "roles",
+	"RoleBinding":             "rolebindings",
+	"PodDisruptionBudget":     "poddisruptionbudgets",
+	"HorizontalPodAutoscaler": "horizontalpodautoscalers",
+}
+
+// liveObjectColumns lists the fields of each object. Lists use [*], which kubectl prints comma
+// joined, so that every row splits into the same number of fields.
+const liveObjectColumns = "custom-columns=KIND:.kind,NAME:.metadata.name,UID:.metadata.uid," +
+	"OWNERS:.metadata.ownerReferences[*].uid,FINALIZERS:.metadata.finalizers[*],DELETED:.metadata.deletionTimestamp"
+
+// parseLiveObjects parses kubectl output in the liveObjectColumns format
+func parseLiveObjects(output, namespace string) []LiveObject {
+	list := func(field string) []string {
+		if field == "<none>" {
+			return nil
+		}
+		return strings.Split(field, ",")
+	}
+
+	var objects []LiveObject
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 6 {
+			continue
+		}
+		objects = append(objects, LiveObject{
+			Kind:        fields[0],
+			Namespace:   namespace,
+			Name:        fields[1],
+			UID:         fields[2],
+			Owners:      list(fields[3]),
+			Finalizers:  list(fields[4]),
+			Terminating: fields[5] != "<none>",
+		})
+	}
+	return objects
+}
+
+// listLiveObjects reads the residueKinds objects of the namespace, or nothing if the namespace
+// is gone. Only metadata is read, so no Secret data ends up in the test log.
+func listLiveObjects(t *testing.T, kubectlOptions *k8s.KubectlOptions) ([]LiveObject, error) {
+	if _, err := k8s.GetNamespaceE(t, kubectlOptions, kubectlOptions.Namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	resources := make([]string, 0, len(residueKinds))
+	for _, resource := range residueKinds {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	output, err := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, "get", strings.Join(resources, ","), "--no-headers", "-o", liveObjectColumns)
+	if err != nil {
+		return nil, err
+	}
+	return parseLiveObjects(output, kubectlOptions.Namespace), nil
+}
+
+// getLiveObject reads a single object, returning nil if it does not exist
+func getLiveObject(t *testing.T, kubectlOptions *k8s.KubectlOptions, kind, name string) (*LiveObject, error) {
+	output, err := k8s.RunKubectlAndGetOutputE(t, kubectlOptions, "get", kind, name, "--ignore-not-found", "--no-headers", "-o", liveObjectColumns)
+	if err != nil {
+		return nil, err
+	}
+	objects := parseLiveObjects(output, kubectlOptions.Namespace)
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	return &objects[0], nil
+}
+
+// helmReleaseRecord reports whether the object is one of the Secrets Helm stores the release in
+func helmReleaseRecord(object LiveObject, release string) bool {
+	return object.Kind == "Secret" && strings.HasPrefix(object.Name, fmt.Sprintf("sh.helm.release.v1.%s.", release))
+}
+
+// DetectResidue returns the live objects that belong to the inventory: the inventory objects
+// themselves, any descendant of them, including ones created after the inventory was recorded,
+// and the Helm release records
+func DetectResidue(inventory ReleaseInventory, live []LiveObject) []LiveObject {
+	owned := make(map[string]bool, len(inventory.Objects))
+	for _, object := range inventory.Objects {
+		owned[object.UID] = true
+	}
+
+	// Follow owner references until no new descendant is found
+	var residue []LiveObject
+	found := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, object := range live {
+			if found[object.UID] {
+				continue
+			}
+			isOwned := owned[object.UID] || helmReleaseRecord(object, inventory.Release)
+			for _, owner := range object.Owners {
+				isOwned = isOwned || owned[owner]
+			}
+			if isOwned {
+				owned[object.UID] = true
+				found[object.UID] = true
+				residue = append(residue, object)
+				changed = true
+			}
+		}
+	}
+	return residue
+}
+
+// RecordReleaseInventory records the objects of the release, to check for residue once the
+// release is destroyed
+func RecordReleaseInventory(t *testing.T, kubectlOptions *k8s.KubectlOptions, release string) ReleaseInventory {
+	objects, err := ParseManifest(GetReleaseManifest(t, kubectlOptions, release))
+	require.NoError(t, err)
+
+	live, err := listLiveObjects(t, kubectlOptions)
+	require.NoError(t, err)
+	byName := make(map[string]LiveObject, len(live))
+	for _, object := range live {
+		byName[fmt.Sprintf("%s/%s", object.Kind, object.Name)] = object
+	}
+
+	inventory := ReleaseInventory{Namespace: kubectlOptions.Namespace, Release: release}
+	for _, manifestObject := range objects {
+		object, ok := byName[manifestObject.String()]
+		if !ok {
+			fetched, err := getLiveObject(t, kubectlOptions, manifestObject.Kind, manifestObject.Metadata.Name)
+			require.NoError(t, err)
+			require.NotNil(t, fetched, "Released object %s should exist", manifestObject)
+			object = *fetched
+		}
+		inventory.Objects = append(inventory.Objects, object)
+	}
+
+	// Pick up the descendants and release records present now
+	inventory.Objects = DetectResidue(inventory, append(live, inventory.Objects...))
+	return inventory
+}
+
+// FindReleaseResidue returns the objects of the inventory still in the cluster
+func FindReleaseResidue(t *testing.T, kubectlOptions *k8s.KubectlOptions, inventory ReleaseInventory) ([]LiveObject, error) {
+	live, err := listLiveObjects(t, kubectlOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects of kinds not listed per namespace are read one by one
+	for _, object := range inventory.Objects {
+		if _, listed := residueKinds[object.Kind]; listed {
+			continue
+		}
+		fetched, err := getLiveObject(t, kubectlOptions, object.Kind, object.Name)
+		if err != nil {
+			return nil, err
+		}
+		if fetched != nil {
+			live = append(live, *fetched)
+		}
+	}
+	return DetectResidue(inventory, live), nil
+}
+
+// ValidateNoReleaseResidue validates that no object of the inventory remains after the release
+// was destroyed, allowing garbage collection some time. Leftovers are reported by Kind/name, with
+// the finalizers of any object stuck terminating.
+func ValidateNoReleaseResidue(t *testing.T, kubectlOptions *k8s.KubectlOptions, inventory ReleaseInventory, retries int, sleepBetweenRetries time.Duration) {
+	var residue []LiveObject
+	_, err := retry.DoWithRetryE(t, fmt.Sprintf("Waiting for release %s to leave no residue", inventory.Release), retries, sleepBetweenRetries, func() (string, error) {
+		var err error
+		residue, err = FindReleaseResidue(t, kubectlOptions, inventory)
+		if err != nil {
+			return "", err
+		}
+		if len(residue) > 0 {
+			return "", fmt.Errorf("%d objects remain", len(residue))
+		}
+		return "", nil
+	})
+	if err == nil {
+		return
+	}
+
+	leftovers := make([]string, 0, len(residue))
+	for _, object := range residue {
+		leftovers = append(leftovers, object.String())
+	}
+	require.Empty(t, leftovers, "Release %s left objects behind in namespace %s", inventory.Release, inventory.Namespace)
+	require.NoError(t, err)
+}
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLiveObjects(t *testing.T) {
+	output := `Deployment   delegate                        uid-1   <none>          <none>               <none>
+Pod          delegate-abc                    uid-2   uid-3           <none>               <none>
+Job          delegate-upgrader-job-123       uid-4   uid-5,uid-6     foregroundDeletion   2024-01-01T00:00:00Z
+Secret       delegate                        uid-7   <none>          example.com/hold,example.com/backup   2024-01-01T00:00:00Z
+`
+	objects := parseLiveObjects(output, "ns")
+	assert.Equal(t, []LiveObject{
+		{Kind: "Deployment", Namespace: "ns", Name: "delegate", UID: "uid-1"},
+		{Kind: "Pod", Namespace: "ns", Name: "delegate-abc", UID: "uid-2", Owners: []string{"uid-3"}},
+		{Kind: "Job", Namespace: "ns", Name: "delegate-upgrader-job-123", UID: "uid-4", Owners: []string{"uid-5", "uid-6"},
+			Finalizers: []string{"foregroundDeletion"}, Terminating: true},
+		{Kind: "Secret", Namespace: "ns", Name: "delegate", UID: "uid-7",
+			Finalizers: []string{"example.com/hold", "example.com/backup"}, Terminating: true},
+	}, objects)
+	assert.Equal(t, "Job/delegate-upgrader-job-123 (stuck on finalizers foregroundDeletion)", objects[2].String())
+	assert.Equal(t, "Pod/delegate-abc", objects[1].String())
+}
+
+func TestDetectResidue(t *testing.T) {
+	inventory := ReleaseInventory{Release: "delegate", Objects: []LiveObject{
+		{Kind: "CronJob", Name: "delegate-upgrader-job", UID: "cronjob"},
+		{Kind: "Secret", Name: "delegate", UID: "secret"},
+	}}
+	live := []LiveObject{
+		// Listed before its owner, and created after the inventory was recorded
+		{Kind: "Pod", Name: "delegate-upgrader-job-1-x", UID: "pod", Owners: []string{"job"}},
+		{Kind: "Job", Name: "delegate-upgrader-job-1", UID: "job", Owners: []string{"cronjob"}},
+		{Kind: "Secret", Name: "delegate", UID: "secret", Finalizers: []string{"example.com/hold"}, Terminating: true},
+		{Kind: "Secret", Name: "sh.helm.release.v1.delegate.v1", UID: "record"},
+		{Kind: "Secret", Name: "sh.helm.release.v1.delegate-other.v1", UID: "other-record"},
+		{Kind: "ConfigMap", Name: "team-config", UID: "unrelated"},
+	}
+
+	var names []string
+	for _, object := range DetectResidue(inventory, live) {
+		names = append(names, object.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"Pod/delegate-upgrader-job-1-x",
+		"Job/delegate-upgrader-job-1",
+		"Secret/delegate (stuck on finalizers example.com/hold)",
+		"Secret/sh.helm.release.v1.delegate.v1",
+	}, names)
+
+	assert.Empty(t, DetectResidue(inventory, live[4:]))
+}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// JVMHeapPolicy configures how the JVM heap is checked against the container memory limit
+type JVMHeapPolicy struct {
+	// EnvVars are searched in order for JVM options; every match is considered and a later one
+	// overrides an earlier one, so they are listed from the lowest precedence to the highest
+	EnvVars []string
+	// HeadroomPercent is the share of the memory limit that must stay free for non-heap memory
+	HeadroomPercent int64
+}
+
+// DefaultJVMHeapPolicy reserves a quarter of the memory limit for metaspace, threads and native memory
+var DefaultJVMHeapPolicy = JVMHeapPolicy{
+	// The JVM reads JAVA_TOOL_OPTIONS first, then JDK_JAVA_OPTIONS, then the command line where the
+	// delegate's start script puts JAVA_OPTS
+	EnvVars:         []string{"JAVA_TOOL_OPTIONS", "JDK_JAVA_OPTIONS", "JAVA_OPTS"},
+	HeadroomPercent: 25,
+}
+
+// JavaHeap is the maximum heap configured through JVM options
+type JavaHeap struct {
+	// Bytes is set when the heap is an absolute size (-Xmx, -XX:MaxHeapSize)
+	Bytes int64
+	// RAMPercent is set when the heap is relative to the container limit (-XX:MaxRAMPercentage)
+	RAMPercent float64
+	// Option is the JVM option the heap was read from
+	Option string
+}
+
+// ParseJavaHeap returns the effective maximum heap from a JVM options string. As with the JVM,
+// the last occurrence of an option wins. ok is false when no maximum heap is configured.
+func ParseJavaHeap(options string) (heap JavaHeap, ok bool, err error) {
+	for _, option := range strings.Fields(options) {
+		switch {
+		case strings.HasPrefix(option, "-Xmx"):
+			heap.Bytes, err = parseJavaSize(strings.TrimPrefix(option, "-Xmx"))
+			heap.RAMPercent = 0
+		case strings.HasPrefix(option, "-XX:MaxHeapSize="):
+			heap.Bytes, err = parseJavaSize(strings.TrimPrefix(option, "-XX:MaxHeapSize="))
+			heap.RAMPercent = 0
+		case strings.HasPrefix(option, "-XX:MaxRAMPercentage="):
+			if heap.Bytes != 0 {
+				// An explicit maximum heap takes precedence over MaxRAMPercentage
+				continue
+			}
+			heap.RAMPercent, err = strconv.ParseFloat(strings.TrimPrefix(option, "-XX:MaxRAMPercentage="), 64)
+		default:
+			continue
+		}
+		if err != nil {
+			return JavaHeap{}, false, fmt.Errorf("invalid JVM option %q: %w", option, err)
+		}
+		heap.Option = option
+		ok = true
+	}
+	return heap, ok, nil
+}
+
+// BytesFor returns the heap size in bytes for the given container memory limit
+func (h JavaHeap) BytesFor(memoryLimit int64) int64 {
+	if h.Bytes != 0 {
+		return h.Bytes
+	}
+	return int64(float64(memoryLimit) * h.RAMPercent / 100)
+}
+
+// parseJavaSize parses JVM sizes such as 512m, 2G or 1048576
+func parseJavaSize(size string) (int64, error) {
+	if size == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := int64(1)
+	switch strings.ToLower(size[len(size)-1:]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	case "t":
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		size = size[:len(size)-1]
+	}
+
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return value * multiplier, nil
+}
+
+// CheckContainerResources returns every problem with the container's requests, limits and JVM heap
+func CheckContainerResources(container corev1.Container, envMap map[string]string, policy JVMHeapPolicy) ([]string, error) {
+	var issues []string
+	requests := container.Resources.Requests
+	limits := container.Resources.Limits
+
+	cpuRequest, hasCPURequest := requests[corev1.ResourceCPU]
+	memoryRequest, hasMemoryRequest := requests[corev1.ResourceMemory]
+	memoryLimit, hasMemoryLimit := limits[corev1.ResourceMemory]
+
+	if !hasCPURequest || cpuRequest.IsZero() {
+		issues = append(issues, "cpu request is not set")
+	}
+	if !hasMemoryRequest || memoryRequest.IsZero() {
+		issues = append(issues, "memory request is not set")
+	}
+	if !hasMemoryLimit || memoryLimit.IsZero() {
+		issues = append(issues, "memory limit is not set")
+	}
+	if cpuLimit, ok := limits[corev1.ResourceCPU]; ok && hasCPURequest && cpuRequest.Cmp(cpuLimit) > 0 {
+		issues = append(issues, fmt.Sprintf("cpu request %s exceeds limit %s", cpuRequest.String(), cpuLimit.String()))
+	}
+	if hasMemoryRequest && hasMemoryLimit && memoryRequest.Cmp(memoryLimit) > 0 {
+		issues = append(issues, fmt.Sprintf("memory request %s exceeds limit %s", memoryRequest.String(), memoryLimit.String()))
+	}
+
+	// The JVM options are concatenated in the order the policy lists them
+	var options []string
+	for _, name := range policy.EnvVars {
+		if value := envMap[name]; value != "" {
+			options = append(options, value)
+		}
+	}
+	heap, found, err := ParseJavaHeap(strings.Join(options, " "))
+	if err != nil {
+		return nil, err
+	}
+	if !found || !hasMemoryLimit {
+		return issues, nil
+	}
+
+	limitBytes := memoryLimit.Value()
+	heapBytes := heap.BytesFor(limitBytes)
+	maxHeapBytes := limitBytes * (100 - policy.HeadroomPercent) / 100
+	if heapBytes > maxHeapBytes {
+		issues = append(issues, fmt.Sprintf("heap %s from %s exceeds %d%% of the memory limit %s (max %s)",
+			resource.NewQuantity(heapBytes, resource.BinarySI).String(), heap.Option, 100-policy.HeadroomPercent,
+			memoryLimit.String(), resource.NewQuantity(maxHeapBytes, resource.BinarySI).String()))
+	}
+
+	return issues, nil
+}
+
+// ValidateContainerResources fails the test if the container's resources or JVM heap are inconsistent
+func ValidateContainerResources(t *testing.T, container corev1.Container, envMap map[string]string, policy JVMHeapPolicy) {
+	issues, err := CheckContainerResources(container, envMap, policy)
+	require.NoError(t, err)
+	require.Empty(t, issues, "Container %s should have consistent resources and heap", container.Name)
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseJavaHeap(t *testing.T) {
+	testCases := []struct {
+		options  string
+		found    bool
+		bytes    int64
+		percent  float64
+		hasError bool
+	}{
+		{options: "-Xms64M", found: false},
+		{options: "-Xms64M -Xmx1536M", found: true, bytes: 1536 << 20},
+		{options: "-Xmx2g -Xmx1g", found: true, bytes: 1 << 30},
+		{options: "-XX:MaxHeapSize=1073741824", found: true, bytes: 1 << 30},
+		{options: "-XX:MaxRAMPercentage=70.0", found: true, percent: 70},
+		{options: "-Xmx512m -XX:MaxRAMPercentage=70.0", found: true, bytes: 512 << 20},
+		{options: "-Xmxlots", hasError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.options, func(t *testing.T) {
+			heap, found, err := ParseJavaHeap(tc.options)
+			if tc.hasError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.bytes, heap.Bytes)
+			assert.Equal(t, tc.percent, heap.RAMPercent)
+		})
+	}
+}
+
+func TestCheckContainerResources(t *testing.T) {
+	container := func(cpuRequest, memoryRequest, memoryLimit string) corev1.Container {
+		resources := corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{},
+			Limits:   corev1.ResourceList{},
+		}
+		if cpuRequest != "" {
+			resources.Requests[corev1.ResourceCPU] = resource.MustParse(cpuRequest)
+		}
+		if memoryRequest != "" {
+			resources.Requests[corev1.ResourceMemory] = resource.MustParse(memoryRequest)
+		}
+		if memoryLimit != "" {
+			resources.Limits[corev1.ResourceMemory] = resource.MustParse(memoryLimit)
+		}
+		return corev1.Container{Name: "delegate", Resources: resources}
+	}
+
+	testCases := []struct {
+		name      string
+		container corev1.Container
+		env       map[string]string
+		issues    int
+	}{
+		{name: "consistent", container: container("0.5", "2Gi", "2Gi"), env: map[string]string{"JAVA_OPTS": "-Xmx1536M"}},
+		{name: "no heap configured", container: container("0.5", "2Gi", "2Gi"), env: map[string]string{"JAVA_OPTS": "-Xms64M"}},
+		{name: "heap above limit", container: container("0.5", "1Gi", "1Gi"), env: map[string]string{"JAVA_OPTS": "-Xmx2G"}, issues: 1},
+		{name: "heap within limit but no headroom", container: container("0.5", "2Gi", "2Gi"), env: map[string]string{"JAVA_OPTS": "-Xmx1900M"}, issues: 1},
+		{name: "ram percentage", container: container("0.5", "2Gi", "2Gi"), env: map[string]string{"JAVA_TOOL_OPTIONS": "-XX:MaxRAMPercentage=90"}, issues: 1},
+		{name: "JAVA_OPTS overrides JAVA_TOOL_OPTIONS", container: container("0.5", "2Gi", "2Gi"), env: map[string]string{"JAVA_TOOL_OPTIONS": "-Xmx1536M", "JAVA_OPTS": "-Xmx1900M"}, issues: 1},
+		{name: "JAVA_TOOL_OPTIONS overridden by JAVA_OPTS", container: container("0.5", "2Gi", "2Gi"), env: map[string]string{"JAVA_TOOL_OPTIONS": "-Xmx1900M", "JAVA_OPTS": "-Xmx1536M"}},
+		{name: "missing requests and limit", container: container("", "", ""), env: map[string]string{"JAVA_OPTS": "-Xmx2G"}, issues: 3},
+		{name: "request above limit", container: container("0.5", "4Gi", "2Gi"), issues: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issues, err := CheckContainerResources(tc.container, tc.env, DefaultJVMHeapPolicy)
+			require.NoError(t, err)
+			assert.Len(t, issues, tc.issues, "%v", issues)
+		})
+	}
+}
+
+func TestRenderedDelegateResources(t *testing.T) {
+	testCases := []struct {
+		overlay    string
+		consistent bool
+	}{
+		{overlay: "resources-consistent.yaml", consistent: true},
+		{overlay: "resources-oom.yaml", consistent: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.overlay, func(t *testing.T) {
+			delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+			vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+			vars["values"] = LoadValuesOverlay(t, tc.overlay)
+
+			objects, err := ParseManifest(RenderDelegateManifest(t, &terraform.Options{
+				TerraformDir: CopyModuleDir(t),
+				Vars:         vars,
+			}))
+			require.NoError(t, err)
+			workloads, err := PodSpecsFromManifest(objects)
+			require.NoError(t, err)
+
+			delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+			container := delegate.Template.Spec.Containers[0]
+			envMap := ResolveRenderedEnvMap(t, objects, container)
+
+			issues, err := CheckContainerResources(container, envMap, DefaultJVMHeapPolicy)
+			require.NoError(t, err)
+			if tc.consistent {
+				assert.Empty(t, issues)
+			} else {
+				assert.NotEmpty(t, issues, "Heap larger than the memory limit should be reported")
+			}
+		})
+	}
+}
+
+func TestDelegateResourcesConsistency(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	replicas := 1
+
+	// Setup the terraform options with explicit resources and heap
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas": replicas,
+		"values":   LoadValuesOverlay(t, "resources-consistent.yaml"),
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Get the Kubernetes config path
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Getting pod list
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	require.Equal(t, replicas, len(pods), "expected number of pods")
+
+	// Validate the live container against its resolved environment
+	container := pods[0].Spec.Containers[0]
+	envMap := ResolveContainerEnvMap(t, kubectlOptions, container)
+	ValidateContainerResources(t, container, envMap, DefaultJVMHeapPolicy)
+}
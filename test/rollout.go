@@ -0,0 +1,236 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// RolloutSample is one observation of a Deployment during a rollout
+type RolloutSample struct {
+	Time time.Time `json:"time"`
+	// Ready counts the Ready pods that are not terminating
+	Ready       int   `json:"ready"`
+	Updated     int32 `json:"updated"`
+	Unavailable int32 `json:"unavailable"`
+}
+
+// RolloutReport summarises the samples taken while watching a rollout
+type RolloutReport struct {
+	Deployment     string          `json:"deployment"`
+	Replicas       int             `json:"replicas"`
+	MaxUnavailable int             `json:"maxUnavailable"`
+	MinReady       int             `json:"minReady"`
+	Samples        []RolloutSample `json:"samples"`
+	// Errors holds API errors from polling; a few are expected while pods churn
+	Errors []string `json:"errors,omitempty"`
+}
+
+// RolloutWatcher polls a Deployment in the background until stopped
+type RolloutWatcher struct {
+	stop     chan struct{}
+	done     chan RolloutReport
+	stopOnce sync.Once
+	report   RolloutReport
+}
+
+// WatchRollout starts polling the Deployment and its pods every pollInterval. Start it before
+// the change that triggers the rollout and call Stop once the Deployment is available again.
+// It is also stopped when the test completes, so that a failing test does not leak the poller.
+func WatchRollout(t *testing.T, kubectlOptions *k8s.KubectlOptions, deploymentName string, pollInterval time.Duration) *RolloutWatcher {
+	deployment := k8s.GetDeployment(t, kubectlOptions, deploymentName)
+	selector := metav1.FormatLabelSelector(deployment.Spec.Selector)
+
+	watcher := &RolloutWatcher{stop: make(chan struct{}), done: make(chan RolloutReport, 1)}
+	go func() {
+		report := RolloutReport{
+			Deployment:     deploymentName,
+			Replicas:       int(*deployment.Spec.Replicas),
+			MaxUnavailable: MaxUnavailable(deployment),
+			MinReady:       int(*deployment.Spec.Replicas),
+		}
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			current, err := k8s.GetDeploymentE(t, kubectlOptions, deploymentName)
+			if err == nil {
+				var pods []corev1.Pod
+				pods, err = k8s.ListPodsE(t, kubectlOptions, metav1.ListOptions{LabelSelector: selector})
+				if err == nil {
+					sample := RolloutSample{
+						Time:        time.Now(),
+						Ready:       countReadyPods(pods),
+						Updated:     current.Status.UpdatedReplicas,
+						Unavailable: current.Status.UnavailableReplicas,
+					}
+					report.Samples = append(report.Samples, sample)
+					if sample.Ready < report.MinReady {
+						report.MinReady = sample.Ready
+					}
+				}
+			}
+			if err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+
+			select {
+			case <-watcher.stop:
+				watcher.done <- report
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		watcher.Stop()
+	})
+
+	return watcher
+}
+
+// Stop stops polling and returns the report. Later calls return the same report.
+func (w *RolloutWatcher) Stop() RolloutReport {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		w.report = <-w.done
+	})
+	return w.report
+}
+
+// MaxUnavailable resolves the number of pods a rolling update may take down, applying the
+// Kubernetes defaults (RollingUpdate with maxUnavailable 25%, rounded down)
+func MaxUnavailable(deployment *appsv1.Deployment) int {
+	replicas := 1
+	if deployment.Spec.Replicas != nil {
+		replicas = int(*deployment.Spec.Replicas)
+	}
+	if deployment.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		return replicas
+	}
+
+	maxUnavailable := intstr.FromString("25%")
+	if rollingUpdate := deployment.Spec.Strategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.MaxUnavailable != nil {
+		maxUnavailable = *rollingUpdate.MaxUnavailable
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, replicas, false)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// ValidateRollout validates that the rollout never dropped below replicas - maxUnavailable
+// Ready pods, nor below minReady
+func ValidateRollout(t *testing.T, report RolloutReport, minReady int) {
+	require.NotEmpty(t, report.Samples, "The rollout of %s should have been observed", report.Deployment)
+
+	floor := report.Replicas - report.MaxUnavailable
+	require.GreaterOrEqual(t, report.MinReady, floor,
+		"Rollout of %s dropped to %d Ready pods, maxUnavailable %d allows no fewer than %d", report.Deployment, report.MinReady, report.MaxUnavailable, floor)
+	require.GreaterOrEqual(t, report.MinReady, minReady,
+		"Rollout of %s dropped to %d Ready pods, expected at least %d", report.Deployment, report.MinReady, minReady)
+}
+
+// FindPodDisruptionBudget returns the PodDisruptionBudget in the namespace whose selector
+// matches the pods
+func FindPodDisruptionBudget(t *testing.T, kubectlOptions *k8s.KubectlOptions, pods []corev1.Pod) *policyv1.PodDisruptionBudget {
+	require.NotEmpty(t, pods, "There should be pods to match")
+
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+	budgets, err := client.PolicyV1().PodDisruptionBudgets(kubectlOptions.Namespace).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	for i := range budgets.Items {
+		budget := &budgets.Items[i]
+		selector, err := metav1.LabelSelectorAsSelector(budget.Spec.Selector)
+		require.NoError(t, err)
+		if selector.Matches(labels.Set(pods[0].Labels)) {
+			return budget
+		}
+	}
+	require.Failf(t, "PodDisruptionBudget not found", "No PodDisruptionBudget in %s selects pod %s", kubectlOptions.Namespace, pods[0].Name)
+	return nil
+}
+
+// ValidatePodDisruptionBudget validates that the budget selects every pod and is enforced for them
+func ValidatePodDisruptionBudget(t *testing.T, budget *policyv1.PodDisruptionBudget, pods []corev1.Pod) {
+	selector, err := metav1.LabelSelectorAsSelector(budget.Spec.Selector)
+	require.NoError(t, err)
+	for _, pod := range pods {
+		require.True(t, selector.Matches(labels.Set(pod.Labels)), "PodDisruptionBudget %s should select pod %s", budget.Name, pod.Name)
+	}
+
+	require.True(t, budget.Spec.MinAvailable != nil || budget.Spec.MaxUnavailable != nil,
+		"PodDisruptionBudget %s should set minAvailable or maxUnavailable", budget.Name)
+	require.Equal(t, int32(len(pods)), budget.Status.ExpectedPods, "PodDisruptionBudget %s should track every pod", budget.Name)
+}
+
+// DrainResult records which pods an eviction-based drain removed and which the budget protected
+type DrainResult struct {
+	Evicted []string `json:"evicted"`
+	Blocked []string `json:"blocked"`
+}
+
+// SimulateDrain evicts the pods one after the other through the eviction API, as `kubectl drain`
+// does, without waiting for replacements. Evictions refused by a PodDisruptionBudget are
+// recorded as blocked; any other error fails the test. Terminating pods are skipped.
+func SimulateDrain(t *testing.T, kubectlOptions *k8s.KubectlOptions, pods []corev1.Pod) DrainResult {
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+
+	var result DrainResult
+	for _, pod := range ActivePods(pods) {
+		err := client.CoreV1().Pods(pod.Namespace).EvictV1(context.Background(), &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		})
+		switch {
+		case err == nil:
+			result.Evicted = append(result.Evicted, pod.Name)
+		case apierrors.IsTooManyRequests(err):
+			result.Blocked = append(result.Blocked, pod.Name)
+		default:
+			require.NoError(t, err, "Evicting pod %s", pod.Name)
+		}
+	}
+	return result
+}
+
+// ActivePods drops the pods that are terminating, such as the old pods right after a rollout
+func ActivePods(pods []corev1.Pod) []corev1.Pod {
+	var active []corev1.Pod
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			active = append(active, pod)
+		}
+	}
+	return active
+}
+
+func countReadyPods(pods []corev1.Pod) int {
+	var ready int
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				ready++
+			}
+		}
+	}
+	return ready
+}
@@ -0,0 +1,152 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestMaxUnavailable(t *testing.T) {
+	deployment := func(replicas int32, strategy appsv1.DeploymentStrategy) *appsv1.Deployment {
+		return &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &replicas, Strategy: strategy}}
+	}
+	rollingUpdate := func(maxUnavailable intstr.IntOrString) appsv1.DeploymentStrategy {
+		return appsv1.DeploymentStrategy{
+			Type:          appsv1.RollingUpdateDeploymentStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &maxUnavailable},
+		}
+	}
+
+	assert.Equal(t, 0, MaxUnavailable(deployment(3, appsv1.DeploymentStrategy{})), "25% of 3 rounds down to 0")
+	assert.Equal(t, 1, MaxUnavailable(deployment(4, appsv1.DeploymentStrategy{})))
+	assert.Equal(t, 1, MaxUnavailable(deployment(3, rollingUpdate(intstr.FromInt(1)))))
+	assert.Equal(t, 1, MaxUnavailable(deployment(3, rollingUpdate(intstr.FromString("50%")))))
+	assert.Equal(t, 3, MaxUnavailable(deployment(3, appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType})))
+}
+
+func TestActivePods(t *testing.T) {
+	deleted := metav1.Now()
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "old", DeletionTimestamp: &deleted}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "new"}},
+	}
+	active := ActivePods(pods)
+	require.Len(t, active, 1)
+	assert.Equal(t, "new", active[0].Name)
+}
+
+func TestRolloutWatcherStop(t *testing.T) {
+	watcher := &RolloutWatcher{stop: make(chan struct{}), done: make(chan RolloutReport, 1)}
+	go func() {
+		<-watcher.stop
+		watcher.done <- RolloutReport{Deployment: "delegate"}
+	}()
+
+	// The test's Stop and WatchRollout's cleanup both stop the watcher
+	assert.Equal(t, "delegate", watcher.Stop().Deployment)
+	assert.Equal(t, "delegate", watcher.Stop().Deployment, "Stopping again should return the same report")
+}
+
+func TestRenderedDelegatePodDisruptionBudget(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+	vars["replicas"] = 3
+	vars["pod_disruption_budget"] = map[string]interface{}{"min_available": 2}
+
+	objects, err := ParseManifest(RenderDelegateManifest(t, &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	}))
+	require.NoError(t, err)
+	workloads, err := PodSpecsFromManifest(objects)
+	require.NoError(t, err)
+	delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+
+	var budgets []policyv1.PodDisruptionBudget
+	for _, object := range objects {
+		if object.Kind != "PodDisruptionBudget" {
+			continue
+		}
+		var budget policyv1.PodDisruptionBudget
+		require.NoError(t, object.Decode(&budget))
+		budgets = append(budgets, budget)
+	}
+	require.Len(t, budgets, 1, "pod_disruption_budget should render a single PodDisruptionBudget")
+
+	budget := budgets[0]
+	require.NotNil(t, budget.Spec.MinAvailable)
+	assert.Equal(t, intstr.FromInt(2), *budget.Spec.MinAvailable)
+	selector, err := metav1.LabelSelectorAsMap(budget.Spec.Selector)
+	require.NoError(t, err)
+	for key, value := range selector {
+		assert.Equal(t, value, delegate.Template.Labels[key], "PodDisruptionBudget selector label %s should match the delegate pods", key)
+	}
+}
+
+func TestDelegateRollingUpdateAndDrain(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	replicas := 3
+	minAvailable := replicas - 1
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas":              replicas,
+		"pod_disruption_budget": map[string]interface{}{"min_available": minAvailable},
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Get the Kubernetes config path
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Change the pod template and watch the rollout
+	watcher := WatchRollout(t, kubectlOptions, delegateName, 2*time.Second)
+	terraformOptions.Vars["values"] = LoadValuesOverlay(t, "rollout-env.yaml")
+	terraform.Apply(t, terraformOptions)
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 20, 30*time.Second)
+	report := watcher.Stop()
+
+	WriteJSONReport(t, "rollout", report)
+	ValidateRollout(t, report, minAvailable)
+
+	// The new pods carry the changed env
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	envMap := ResolveContainerEnvMap(t, kubectlOptions, deployment.Spec.Template.Spec.Containers[0])
+	require.Equal(t, "rolled", envMap["ROLLOUT_MARKER"], "The rollout should apply the overlay")
+
+	// Getting pod list, without the old pods still terminating
+	pods := ActivePods(k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	}))
+	require.Equal(t, replicas, len(pods), "expected number of pods")
+
+	budget := FindPodDisruptionBudget(t, kubectlOptions, pods)
+	ValidatePodDisruptionBudget(t, budget, pods)
+
+	// Draining every node at once may only take down replicas - minAvailable pods
+	drain := SimulateDrain(t, kubectlOptions, pods)
+	assert.Len(t, drain.Evicted, replicas-minAvailable, "Evictions beyond the budget should be refused")
+	assert.Len(t, drain.Blocked, minAvailable, "The budget should protect the remaining pods")
+
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 20, 30*time.Second)
+}
@@ -0,0 +1,335 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TokenChecksumAnnotation is the pod annotation the module sets to the SHA-256 of the delegate
+// token, so that rotating the token rolls the pods
+const TokenChecksumAnnotation = "checksum/delegate-token"
+
+// TokenChecksum returns the value of TokenChecksumAnnotation for token
+func TokenChecksum(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateSecretsRedacted validates that none of the secrets appear in output, either verbatim
+// or base64 encoded as in Secret manifests
+func ValidateSecretsRedacted(t *testing.T, output string, secrets ...string) {
+	for i, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		// Plain checks, as a failed NotContains would print the secret itself
+		require.False(t, strings.Contains(output, secret), "Secret #%d should not appear in the output", i)
+		require.False(t, strings.Contains(output, base64.StdEncoding.EncodeToString([]byte(secret))), "Secret #%d should not appear base64 encoded in the output", i)
+	}
+}
+
+// ValidateStateHasNoSecrets validates that the raw Terraform state, as returned by
+// `terraform state pull`, holds none of the secrets
+func ValidateStateHasNoSecrets(t *testing.T, terraformOptions *terraform.Options, secrets ...string) {
+	state, err := terraform.RunTerraformCommandAndGetStdoutE(t, terraformOptions, "state", "pull")
+	require.NoError(t, err)
+	require.NotEmpty(t, state, "The state should not be empty")
+	ValidateSecretsRedacted(t, state, secrets...)
+}
+
+// CreateDelegateTokenSecret creates a Secret holding the delegate token under key. The client
+// is used directly rather than kubectl so that the token is never logged.
+func CreateDelegateTokenSecret(t *testing.T, kubectlOptions *k8s.KubectlOptions, name, key, token string) {
+	client, err := k8s.GetKubernetesClientFromOptionsE(t, kubectlOptions)
+	require.NoError(t, err)
+
+	_, err = client.CoreV1().Secrets(kubectlOptions.Namespace).Create(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: kubectlOptions.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{key: []byte(token)},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err, "Creating Secret %s", name)
+}
+
+// WaitForPodsReplaced waits until the selector matches exactly replicas Ready pods, none of which
+// is one of the old pods, and returns them
+func WaitForPodsReplaced(t *testing.T, kubectlOptions *k8s.KubectlOptions, selector string, old []corev1.Pod, replicas int, retries int, sleepBetweenRetries time.Duration) []corev1.Pod {
+	oldNames := make(map[string]bool, len(old))
+	for _, pod := range old {
+		oldNames[pod.Name] = true
+	}
+
+	var replaced []corev1.Pod
+	retry.DoWithRetry(t, "Waiting for the pods to be replaced", retries, sleepBetweenRetries, func() (string, error) {
+		pods, err := k8s.ListPodsE(t, kubectlOptions, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return "", err
+		}
+
+		var remaining []string
+		replaced = replaced[:0]
+		for _, pod := range pods {
+			if oldNames[pod.Name] {
+				remaining = append(remaining, pod.Name)
+				continue
+			}
+			if countReadyPods([]corev1.Pod{pod}) == 1 {
+				replaced = append(replaced, pod)
+			}
+		}
+		if len(remaining) > 0 {
+			return "", fmt.Errorf("old pods still present: %s", strings.Join(remaining, ", "))
+		}
+		if len(replaced) != replicas {
+			return "", fmt.Errorf("%d/%d new pods Ready", len(replaced), replicas)
+		}
+		return "", nil
+	})
+	return replaced
+}
+
+// sensitivePaths marks the sensitive parts of a value: all of it, or some of its children, keyed
+// by attribute name, map key or list index
+type sensitivePaths struct {
+	all      bool
+	children map[string]*sensitivePaths
+}
+
+func (s *sensitivePaths) child(key string) *sensitivePaths {
+	if s == nil {
+		return nil
+	}
+	return s.children[key]
+}
+
+func (s *sensitivePaths) add(steps []string) {
+	node := s
+	for _, step := range steps {
+		if node.children == nil {
+			node.children = make(map[string]*sensitivePaths)
+		}
+		if node.children[step] == nil {
+			node.children[step] = &sensitivePaths{}
+		}
+		node = node.children[step]
+	}
+	node.all = true
+}
+
+// sensitiveValuesPaths reads the sensitive_values of `terraform show -json`, which mirrors the
+// values with true at the sensitive ones
+func sensitiveValuesPaths(mask interface{}) *sensitivePaths {
+	switch m := mask.(type) {
+	case bool:
+		return &sensitivePaths{all: m}
+	case map[string]interface{}:
+		paths := &sensitivePaths{children: make(map[string]*sensitivePaths, len(m))}
+		for key, value := range m {
+			paths.children[key] = sensitiveValuesPaths(value)
+		}
+		return paths
+	case []interface{}:
+		paths := &sensitivePaths{children: make(map[string]*sensitivePaths, len(m))}
+		for i, value := range m {
+			paths.children[fmt.Sprint(i)] = sensitiveValuesPaths(value)
+		}
+		return paths
+	}
+	return nil
+}
+
+// exposedSecrets returns the paths of the strings in value that hold one of the secrets, verbatim
+// or base64 encoded, outside of the sensitive paths
+func exposedSecrets(value interface{}, sensitive *sensitivePaths, path string, secrets []string) []string {
+	if sensitive != nil && sensitive.all {
+		return nil
+	}
+
+	var exposed []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			exposed = append(exposed, exposedSecrets(child, sensitive.child(key), path+"."+key, secrets)...)
+		}
+	case []interface{}:
+		for i, child := range v {
+			exposed = append(exposed, exposedSecrets(child, sensitive.child(fmt.Sprint(i)), fmt.Sprintf("%s[%d]", path, i), secrets)...)
+		}
+	case string:
+		for _, secret := range secrets {
+			if secret != "" && (strings.Contains(v, secret) || strings.Contains(v, base64.StdEncoding.EncodeToString([]byte(secret)))) {
+				exposed = append(exposed, path)
+				break
+			}
+		}
+	}
+	sort.Strings(exposed)
+	return exposed
+}
+
+// ShowExposedSecrets returns the resource attributes and outputs of `terraform show -json` that
+// hold one of the secrets without being marked sensitive. The JSON output is not redacted, so
+// sensitive values are skipped rather than expected to be absent.
+func ShowExposedSecrets(showJSON string, secrets ...string) ([]string, error) {
+	var state tfjson.State
+	if err := json.Unmarshal([]byte(showJSON), &state); err != nil {
+		return nil, err
+	}
+	if state.Values == nil {
+		return nil, nil
+	}
+
+	var exposed []string
+	for name, output := range state.Values.Outputs {
+		if !output.Sensitive {
+			exposed = append(exposed, exposedSecrets(output.Value, nil, "output."+name, secrets)...)
+		}
+	}
+	modules := []*tfjson.StateModule{state.Values.RootModule}
+	for len(modules) > 0 {
+		module := modules[0]
+		modules = append(modules[1:], module.ChildModules...)
+		if module == nil {
+			continue
+		}
+		for _, resource := range module.Resources {
+			var mask interface{}
+			if len(resource.SensitiveValues) > 0 {
+				if err := json.Unmarshal(resource.SensitiveValues, &mask); err != nil {
+					return nil, fmt.Errorf("%s: %w", resource.Address, err)
+				}
+			}
+			exposed = append(exposed, exposedSecrets(resource.AttributeValues, sensitiveValuesPaths(mask), resource.Address, secrets)...)
+		}
+	}
+	sort.Strings(exposed)
+	return exposed, nil
+}
+
+// rawState is the part of the state format version 4, as returned by `terraform state pull`, that
+// holds values
+type rawState struct {
+	Outputs map[string]struct {
+		Value     interface{} `json:"value"`
+		Sensitive bool        `json:"sensitive"`
+	} `json:"outputs"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey            interface{}   `json:"index_key"`
+			Attributes          interface{}   `json:"attributes"`
+			SensitiveAttributes [][]stateStep `json:"sensitive_attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// stateStep is a step of a sensitive attribute path in the state
+type stateStep struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// key returns the attribute name of a get_attr step, or the key of an index step
+func (s stateStep) key() (string, error) {
+	if s.Type == "get_attr" {
+		var name string
+		err := json.Unmarshal(s.Value, &name)
+		return name, err
+	}
+	var index struct {
+		Value interface{} `json:"value"`
+	}
+	err := json.Unmarshal(s.Value, &index)
+	return fmt.Sprint(index.Value), err
+}
+
+// StateExposedSecrets returns the attributes and outputs of a raw state, as returned by
+// `terraform state pull`, that hold one of the secrets without being marked sensitive
+func StateExposedSecrets(state string, secrets ...string) ([]string, error) {
+	var raw rawState
+	if err := json.Unmarshal([]byte(state), &raw); err != nil {
+		return nil, err
+	}
+
+	var exposed []string
+	for name, output := range raw.Outputs {
+		if !output.Sensitive {
+			exposed = append(exposed, exposedSecrets(output.Value, nil, "output."+name, secrets)...)
+		}
+	}
+	for _, resource := range raw.Resources {
+		address := resource.Type + "." + resource.Name
+		if resource.Mode == "data" {
+			address = "data." + address
+		}
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+		for _, instance := range resource.Instances {
+			instanceAddress := address
+			if instance.IndexKey != nil {
+				instanceAddress = fmt.Sprintf("%s[%v]", address, instance.IndexKey)
+			}
+			sensitive := &sensitivePaths{}
+			for _, steps := range instance.SensitiveAttributes {
+				path := make([]string, len(steps))
+				for i, step := range steps {
+					key, err := step.key()
+					if err != nil {
+						return nil, fmt.Errorf("%s: %w", instanceAddress, err)
+					}
+					path[i] = key
+				}
+				sensitive.add(path)
+			}
+			exposed = append(exposed, exposedSecrets(instance.Attributes, sensitive, instanceAddress, secrets)...)
+		}
+	}
+	sort.Strings(exposed)
+	return exposed, nil
+}
+
+// ValidateSecretsOnlyInSensitiveValues validates that `terraform show` never prints the secrets,
+// and that `terraform show -json` and the raw state only hold them in values marked sensitive,
+// such as the helm release's set_sensitive. Only leaving the secrets out of the module, as the
+// existing token Secret does, keeps them out of the state entirely (see ValidateStateHasNoSecrets).
+func ValidateSecretsOnlyInSensitiveValues(t *testing.T, terraformOptions *terraform.Options, secrets ...string) {
+	show, err := terraform.RunTerraformCommandAndGetStdoutE(t, terraformOptions, "show", "-no-color")
+	require.NoError(t, err)
+	ValidateSecretsRedacted(t, show, secrets...)
+
+	// The JSON output and the state hold the sensitive values in clear, so they are not logged
+	quiet := *terraformOptions
+	quiet.Logger = logger.Discard
+	showJSON, err := terraform.ShowE(t, &quiet)
+	require.NoError(t, err)
+	exposed, err := ShowExposedSecrets(showJSON, secrets...)
+	require.NoError(t, err)
+	require.Empty(t, exposed, "terraform show -json should only hold the secrets in sensitive values")
+
+	state, err := terraform.RunTerraformCommandAndGetStdoutE(t, &quiet, "state", "pull")
+	require.NoError(t, err)
+	exposed, err = StateExposedSecrets(state, secrets...)
+	require.NoError(t, err)
+	require.Empty(t, exposed, "The state should only hold the secrets in sensitive attributes")
+}
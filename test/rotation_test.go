@@ -0,0 +1,157 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderedDelegateTokenChecksum(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+
+	render := func(token string) WorkloadPodSpec {
+		vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+		vars["delegate_token"] = token
+		workloads := RenderedWorkloads(t, &terraform.Options{
+			TerraformDir: CopyModuleDir(t),
+			Vars:         vars,
+		})
+		return FindWorkload(t, workloads, "Deployment", delegateName)
+	}
+
+	before := render("first-token")
+	after := render("rotated-token")
+
+	assert.Equal(t, TokenChecksum("first-token"), before.Template.Annotations[TokenChecksumAnnotation])
+	assert.Equal(t, TokenChecksum("rotated-token"), after.Template.Annotations[TokenChecksumAnnotation])
+	assert.NotEqual(t, before.Template.Annotations[TokenChecksumAnnotation], after.Template.Annotations[TokenChecksumAnnotation],
+		"Rotating the token should change the pod template")
+}
+
+func TestShowExposedSecrets(t *testing.T) {
+	// The token in set_sensitive is marked sensitive, the one in the release metadata is not
+	show := `{
+  "format_version": "1.0",
+  "values": {
+    "outputs": {
+      "values": {"sensitive": false, "value": "accountId: abc\n"},
+      "token": {"sensitive": true, "value": "hunter2"}
+    },
+    "root_module": {
+      "resources": [{
+        "address": "helm_release.delegate",
+        "mode": "managed",
+        "type": "helm_release",
+        "name": "delegate",
+        "values": {
+          "set_sensitive": [{"name": "delegateToken", "value": "hunter2", "type": "string"}],
+          "metadata": [{"values": "{\"delegateToken\":\"hunter2\"}"}]
+        },
+        "sensitive_values": {"set_sensitive": true, "metadata": [{}]}
+      }]
+    }
+  }
+}`
+
+	exposed, err := ShowExposedSecrets(show, "hunter2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"helm_release.delegate.metadata[0].values"}, exposed)
+
+	exposed, err = ShowExposedSecrets(show, "other-token")
+	require.NoError(t, err)
+	assert.Empty(t, exposed)
+}
+
+func TestStateExposedSecrets(t *testing.T) {
+	state := `{
+  "version": 4,
+  "outputs": {"values": {"value": "accountId: abc\n", "type": "string"}},
+  "resources": [{
+    "mode": "managed",
+    "type": "helm_release",
+    "name": "delegate",
+    "instances": [{
+      "attributes": {
+        "set_sensitive": [{"name": "delegateToken", "value": "hunter2", "type": "string"}],
+        "metadata": [{"values": "{}"}],
+        "manifest": "DELEGATE_TOKEN: aHVudGVyMg=="
+      },
+      "sensitive_attributes": [[{"type": "get_attr", "value": "set_sensitive"}, {"type": "index", "value": {"value": 0, "type": "number"}}]]
+    }]
+  }]
+}`
+
+	// The manifest holds the token base64 encoded, outside of the sensitive attributes
+	exposed, err := StateExposedSecrets(state, "hunter2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"helm_release.delegate.manifest"}, exposed)
+
+	_, err = StateExposedSecrets("not json")
+	assert.Error(t, err)
+}
+
+func TestDelegateTokenRotation(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+	env := LoadLiveDelegateEnv()
+	rotated_token := os.Getenv("DELEGATE_TOKEN_ROTATED")
+	replicas := 2
+
+	if rotated_token == "" || rotated_token == env.DelegateToken {
+		t.Skip("DELEGATE_TOKEN_ROTATED should be set to a second valid token")
+	}
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas": replicas,
+	})
+
+	// Run terraform init and apply
+	output := terraform.InitAndApply(t, terraformOptions)
+	ValidateSecretsRedacted(t, output, env.DelegateToken)
+
+	// Get the Kubernetes config path
+	kubectlOptions := testNamespace.KubectlOptions
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	selector := metav1.FormatLabelSelector(deployment.Spec.Selector)
+	oldPods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{LabelSelector: selector})
+	require.Equal(t, replicas, len(oldPods), "expected number of pods")
+
+	// Rotate the token, through the environment like the first one; neither may show up in the plan
+	terraformOptions.Vars["delegate_token"] = rotated_token
+	MoveSecretVarsToEnv(t, terraformOptions)
+	planOutput := terraform.Plan(t, terraformOptions)
+	ValidateSecretsRedacted(t, planOutput, env.DelegateToken, rotated_token)
+	require.Contains(t, planOutput, TokenChecksumAnnotation, "The plan should show the checksum annotation change")
+
+	output = terraform.Apply(t, terraformOptions)
+	ValidateSecretsRedacted(t, output, env.DelegateToken, rotated_token)
+	ValidateSecretsOnlyInSensitiveValues(t, terraformOptions, env.DelegateToken, rotated_token)
+
+	// The Secret holds the new token and every old pod is replaced by one using it
+	secret := k8s.GetSecret(t, kubectlOptions, delegateName)
+	require.Equal(t, TokenChecksum(rotated_token), TokenChecksum(string(secret.Data["DELEGATE_TOKEN"])), "Secret %s should hold the rotated token", delegateName)
+
+	newPods := WaitForPodsReplaced(t, kubectlOptions, selector, oldPods, replicas, 40, 15*time.Second)
+	for _, pod := range newPods {
+		assert.Equal(t, TokenChecksum(rotated_token), pod.Annotations[TokenChecksumAnnotation], "Pod %s should carry the rotated checksum", pod.Name)
+		envMap := ResolveContainerEnvMap(t, kubectlOptions, pod.Spec.Containers[0])
+		assert.Equal(t, TokenChecksum(rotated_token), TokenChecksum(envMap["DELEGATE_TOKEN"]), "Pod %s should use the rotated token", pod.Name)
+	}
+}
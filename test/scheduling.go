@@ -0,0 +1,268 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// SchedulingExpectation describes the placement a workload should be configured with
+type SchedulingExpectation struct {
+	NodeSelector map[string]string
+	Tolerations  []corev1.Toleration
+	// TopologyKeys lists the topology keys the pods should be spread across
+	TopologyKeys []string
+	// RequiredNodeAffinity is set when the pods should have required node affinity terms
+	RequiredNodeAffinity bool
+}
+
+// CheckScheduling compares the scheduling fields of a pod spec with the expectation and
+// returns one message per difference
+func CheckScheduling(spec corev1.PodSpec, expected SchedulingExpectation) []string {
+	var issues []string
+
+	for key, value := range expected.NodeSelector {
+		if actual, ok := spec.NodeSelector[key]; !ok || actual != value {
+			issues = append(issues, fmt.Sprintf("nodeSelector %s should be %q, got %q", key, value, actual))
+		}
+	}
+
+	for _, toleration := range expected.Tolerations {
+		var found bool
+		for _, actual := range spec.Tolerations {
+			if actual.MatchToleration(&toleration) && tolerationSecondsEqual(actual.TolerationSeconds, toleration.TolerationSeconds) {
+				found = true
+			}
+		}
+		if !found {
+			issues = append(issues, fmt.Sprintf("missing toleration %s", toleration.String()))
+		}
+	}
+
+	for _, key := range expected.TopologyKeys {
+		var found bool
+		for _, constraint := range spec.TopologySpreadConstraints {
+			if constraint.TopologyKey == key {
+				found = true
+			}
+		}
+		if !found {
+			issues = append(issues, fmt.Sprintf("missing topology spread constraint on %s", key))
+		}
+	}
+
+	if expected.RequiredNodeAffinity {
+		affinity := spec.Affinity
+		if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			issues = append(issues, "missing required node affinity")
+		}
+	}
+
+	sort.Strings(issues)
+	return issues
+}
+
+// ValidateScheduling validates the scheduling fields of every workload against the expectation
+func ValidateScheduling(t *testing.T, workloads []WorkloadPodSpec, expected SchedulingExpectation) {
+	for _, workload := range workloads {
+		issues := CheckScheduling(workload.Template.Spec, expected)
+		require.Empty(t, issues, "%s scheduling does not match the module inputs", workload)
+	}
+}
+
+// NodeMatchesPodSpec reports whether the scheduler may place a pod with spec on node: the node
+// satisfies the nodeSelector and the required node affinity, and the pod tolerates its
+// NoSchedule and NoExecute taints
+func NodeMatchesPodSpec(node corev1.Node, spec corev1.PodSpec) (bool, error) {
+	matched, err := nodeMatchesAffinity(node, spec)
+	if err != nil || !matched {
+		return false, err
+	}
+	return nodeTaintsTolerated(node, spec), nil
+}
+
+// nodeMatchesAffinity reports whether node satisfies the nodeSelector and the required node affinity
+func nodeMatchesAffinity(node corev1.Node, spec corev1.PodSpec) (bool, error) {
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false, nil
+	}
+
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil {
+		if required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil {
+			return nodeMatchesSelectorTerms(node, required.NodeSelectorTerms)
+		}
+	}
+	return true, nil
+}
+
+// nodeTaintsTolerated reports whether the pod tolerates the NoSchedule and NoExecute taints of node
+func nodeTaintsTolerated(node corev1.Node, spec corev1.PodSpec) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		var tolerated bool
+		for _, toleration := range spec.Tolerations {
+			if toleration.ToleratesTaint(&taint) {
+				tolerated = true
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeMatchesSelectorTerms ORs the terms; the expressions of a term are ANDed
+func nodeMatchesSelectorTerms(node corev1.Node, terms []corev1.NodeSelectorTerm) (bool, error) {
+	for _, term := range terms {
+		if len(term.MatchExpressions) == 0 {
+			continue
+		}
+		selector := labels.NewSelector()
+		for _, expression := range term.MatchExpressions {
+			var operator selection.Operator
+			switch expression.Operator {
+			case corev1.NodeSelectorOpIn:
+				operator = selection.In
+			case corev1.NodeSelectorOpNotIn:
+				operator = selection.NotIn
+			case corev1.NodeSelectorOpExists:
+				operator = selection.Exists
+			case corev1.NodeSelectorOpDoesNotExist:
+				operator = selection.DoesNotExist
+			case corev1.NodeSelectorOpGt:
+				operator = selection.GreaterThan
+			case corev1.NodeSelectorOpLt:
+				operator = selection.LessThan
+			default:
+				return false, fmt.Errorf("unsupported node selector operator %q", expression.Operator)
+			}
+			requirement, err := labels.NewRequirement(expression.Key, operator, expression.Values)
+			if err != nil {
+				return false, err
+			}
+			selector = selector.Add(*requirement)
+		}
+		if selector.Matches(labels.Set(node.Labels)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TopologyDistribution counts the pods in every topology domain of the constraint's topologyKey.
+// Domains of nodes the scheduler counts for the constraint are included even when they hold no
+// pods. As in Kubernetes, those nodes must match the node affinity and nodeSelector unless
+// nodeAffinityPolicy is Ignore, and tolerated taints only matter when nodeTaintsPolicy is Honor.
+func TopologyDistribution(pods []corev1.Pod, nodes []corev1.Node, constraint corev1.TopologySpreadConstraint) (map[string]int, error) {
+	distribution := make(map[string]int)
+	domains := make(map[string]string, len(nodes))
+	topologyKey := constraint.TopologyKey
+
+	for _, node := range nodes {
+		domain, ok := node.Labels[topologyKey]
+		if !ok {
+			continue
+		}
+		domains[node.Name] = domain
+		if len(pods) == 0 {
+			continue
+		}
+		eligible, err := nodeCountsForSpread(node, pods[0].Spec, constraint)
+		if err != nil {
+			return nil, err
+		}
+		if _, seen := distribution[domain]; eligible && !seen {
+			distribution[domain] = 0
+		}
+	}
+
+	for _, pod := range pods {
+		domain, ok := domains[pod.Spec.NodeName]
+		if !ok {
+			return nil, fmt.Errorf("pod %s is not on a node labelled %s", pod.Name, topologyKey)
+		}
+		distribution[domain]++
+	}
+	return distribution, nil
+}
+
+// nodeCountsForSpread applies the node inclusion policies of the constraint, whose defaults are
+// Honor for node affinity and Ignore for taints
+func nodeCountsForSpread(node corev1.Node, spec corev1.PodSpec, constraint corev1.TopologySpreadConstraint) (bool, error) {
+	if constraint.NodeAffinityPolicy == nil || *constraint.NodeAffinityPolicy == corev1.NodeInclusionPolicyHonor {
+		matched, err := nodeMatchesAffinity(node, spec)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if constraint.NodeTaintsPolicy != nil && *constraint.NodeTaintsPolicy == corev1.NodeInclusionPolicyHonor {
+		return nodeTaintsTolerated(node, spec), nil
+	}
+	return true, nil
+}
+
+// TopologySkew returns the difference between the most and the least populated domains
+func TopologySkew(distribution map[string]int) int {
+	if len(distribution) == 0 {
+		return 0
+	}
+	first := true
+	var lowest, highest int
+	for _, count := range distribution {
+		if first || count < lowest {
+			lowest = count
+		}
+		if first || count > highest {
+			highest = count
+		}
+		first = false
+	}
+	return highest - lowest
+}
+
+// ValidatePodPlacement validates that every pod landed on a node matching its nodeSelector,
+// required node affinity and tolerations, and that the DoNotSchedule topology spread
+// constraints hold across the nodes of the cluster
+func ValidatePodPlacement(t *testing.T, kubectlOptions *k8s.KubectlOptions, pods []corev1.Pod) {
+	require.NotEmpty(t, pods, "There should be pods to validate")
+	nodes := k8s.GetNodes(t, kubectlOptions)
+
+	nodesByName := make(map[string]corev1.Node, len(nodes))
+	for _, node := range nodes {
+		nodesByName[node.Name] = node
+	}
+
+	for _, pod := range pods {
+		node, ok := nodesByName[pod.Spec.NodeName]
+		require.True(t, ok, "Pod %s should be scheduled on a known node", pod.Name)
+		matched, err := NodeMatchesPodSpec(node, pod.Spec)
+		require.NoError(t, err)
+		require.True(t, matched, "Pod %s landed on node %s which does not match its scheduling constraints", pod.Name, node.Name)
+	}
+
+	for _, constraint := range pods[0].Spec.TopologySpreadConstraints {
+		if constraint.WhenUnsatisfiable != corev1.DoNotSchedule {
+			continue
+		}
+		distribution, err := TopologyDistribution(pods, nodes, constraint)
+		require.NoError(t, err)
+		require.LessOrEqual(t, TopologySkew(distribution), int(constraint.MaxSkew),
+			"Pods should be spread across %s with max skew %d, got %v", constraint.TopologyKey, constraint.MaxSkew, distribution)
+	}
+}
+
+func tolerationSecondsEqual(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
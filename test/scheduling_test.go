@@ -0,0 +1,220 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testNode(name string, nodeLabels map[string]string, taints ...corev1.Taint) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nodeLabels},
+		Spec:       corev1.NodeSpec{Taints: taints},
+	}
+}
+
+func TestNodeMatchesPodSpec(t *testing.T) {
+	toolingTaint := corev1.Taint{Key: "dedicated", Value: "tooling", Effect: corev1.TaintEffectNoSchedule}
+	toolingNode := testNode("tooling", map[string]string{"pool": "tooling", "topology.kubernetes.io/zone": "a"}, toolingTaint)
+	generalNode := testNode("general", map[string]string{"pool": "general", "topology.kubernetes.io/zone": "b"})
+
+	toleratesTooling := []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "tooling", Effect: corev1.TaintEffectNoSchedule}}
+	zoneAffinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+			MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}},
+		}}},
+	}}
+
+	testCases := []struct {
+		name    string
+		node    corev1.Node
+		spec    corev1.PodSpec
+		matches bool
+	}{
+		{name: "selector and toleration", node: toolingNode, spec: corev1.PodSpec{NodeSelector: map[string]string{"pool": "tooling"}, Tolerations: toleratesTooling}, matches: true},
+		{name: "untolerated taint", node: toolingNode, spec: corev1.PodSpec{NodeSelector: map[string]string{"pool": "tooling"}}},
+		{name: "selector mismatch", node: generalNode, spec: corev1.PodSpec{NodeSelector: map[string]string{"pool": "tooling"}, Tolerations: toleratesTooling}},
+		{name: "required affinity", node: generalNode, spec: corev1.PodSpec{Affinity: zoneAffinity}, matches: true},
+		{name: "required affinity mismatch", node: toolingNode, spec: corev1.PodSpec{Affinity: zoneAffinity, Tolerations: toleratesTooling}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := NodeMatchesPodSpec(tc.node, tc.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tc.matches, matches)
+		})
+	}
+}
+
+func TestTopologyDistribution(t *testing.T) {
+	nodes := []corev1.Node{
+		testNode("node-a", map[string]string{"topology.kubernetes.io/zone": "a"}),
+		testNode("node-b", map[string]string{"topology.kubernetes.io/zone": "b"}),
+		testNode("node-c", map[string]string{"topology.kubernetes.io/zone": "c"}),
+	}
+	pod := func(name, nodeName string) corev1.Pod {
+		return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: corev1.PodSpec{NodeName: nodeName}}
+	}
+
+	zone := corev1.TopologySpreadConstraint{TopologyKey: "topology.kubernetes.io/zone"}
+
+	distribution, err := TopologyDistribution([]corev1.Pod{pod("p0", "node-a"), pod("p1", "node-a"), pod("p2", "node-b")}, nodes, zone)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 2, "b": 1, "c": 0}, distribution, "Empty eligible domains count towards the skew")
+	assert.Equal(t, 2, TopologySkew(distribution))
+
+	_, err = TopologyDistribution([]corev1.Pod{pod("p0", "unknown")}, nodes, zone)
+	assert.Error(t, err)
+}
+
+func TestTopologyDistributionNodeInclusionPolicies(t *testing.T) {
+	taint := corev1.Taint{Key: "dedicated", Value: "batch", Effect: corev1.TaintEffectNoSchedule}
+	nodes := []corev1.Node{
+		testNode("node-a", map[string]string{"topology.kubernetes.io/zone": "a", "pool": "tooling"}),
+		testNode("node-b", map[string]string{"topology.kubernetes.io/zone": "b", "pool": "tooling"}, taint),
+		testNode("node-c", map[string]string{"topology.kubernetes.io/zone": "c", "pool": "general"}),
+	}
+	pods := []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "p0"},
+		Spec:       corev1.PodSpec{NodeName: "node-a", NodeSelector: map[string]string{"pool": "tooling"}},
+	}}
+	honor, ignore := corev1.NodeInclusionPolicyHonor, corev1.NodeInclusionPolicyIgnore
+
+	testCases := []struct {
+		name       string
+		constraint corev1.TopologySpreadConstraint
+		expected   map[string]int
+	}{
+		{name: "defaults", expected: map[string]int{"a": 1, "b": 0}},
+		{name: "honor taints", constraint: corev1.TopologySpreadConstraint{NodeTaintsPolicy: &honor}, expected: map[string]int{"a": 1}},
+		{name: "ignore affinity", constraint: corev1.TopologySpreadConstraint{NodeAffinityPolicy: &ignore}, expected: map[string]int{"a": 1, "b": 0, "c": 0}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.constraint.TopologyKey = "topology.kubernetes.io/zone"
+			distribution, err := TopologyDistribution(pods, nodes, tc.constraint)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, distribution)
+		})
+	}
+}
+
+func TestRenderedDelegateScheduling(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+	vars["node_selector"] = map[string]string{"pool": "tooling"}
+	vars["tolerations"] = []map[string]interface{}{
+		{"key": "dedicated", "value": "tooling", "effect": "NoSchedule"},
+	}
+	vars["affinity"] = map[string]interface{}{
+		"nodeAffinity": map[string]interface{}{
+			"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+				"nodeSelectorTerms": []map[string]interface{}{{
+					"matchExpressions": []map[string]interface{}{{"key": "kubernetes.io/os", "operator": "In", "values": []string{"linux"}}},
+				}},
+			},
+		},
+	}
+	vars["topology_spread_constraints"] = []map[string]interface{}{
+		{"topology_key": "topology.kubernetes.io/zone"},
+	}
+
+	workloads := RenderedWorkloads(t, &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	})
+
+	delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+	ValidateScheduling(t, []WorkloadPodSpec{delegate}, SchedulingExpectation{
+		NodeSelector:         map[string]string{"pool": "tooling"},
+		Tolerations:          []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "tooling", Effect: corev1.TaintEffectNoSchedule}},
+		TopologyKeys:         []string{"topology.kubernetes.io/zone"},
+		RequiredNodeAffinity: true,
+	})
+
+	// The default selector must select the release's own pods
+	constraint := delegate.Template.Spec.TopologySpreadConstraints[0]
+	require.NotNil(t, constraint.LabelSelector)
+	assert.Equal(t, int32(1), constraint.MaxSkew)
+	assert.Equal(t, corev1.DoNotSchedule, constraint.WhenUnsatisfiable)
+	for key, value := range constraint.LabelSelector.MatchLabels {
+		assert.Equal(t, value, delegate.Template.Labels[key], "Spread selector label %s should match the pod template", key)
+	}
+}
+
+func TestDelegateSpreadAcrossNodes(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := random.UniqueId()
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(uniqueID))
+	testNamespace := AllocateNamespace(t, "harness-delegate-ng")
+
+	// Spread across nodes by default; SPREAD_TOPOLOGY_KEY selects e.g. zones instead
+	topologyKey := os.Getenv("SPREAD_TOPOLOGY_KEY")
+	if topologyKey == "" {
+		topologyKey = "kubernetes.io/hostname"
+	}
+	nodeSelector := map[string]string{"kubernetes.io/os": "linux"}
+
+	// One replica per domain, so a skew of 1 proves the pods are spread
+	kubectlOptions := testNamespace.KubectlOptions
+	domains := make(map[string]bool)
+	for _, node := range k8s.GetNodes(t, kubectlOptions) {
+		matches, err := NodeMatchesPodSpec(node, corev1.PodSpec{NodeSelector: nodeSelector})
+		require.NoError(t, err)
+		if domain, ok := node.Labels[topologyKey]; ok && matches {
+			domains[domain] = true
+		}
+	}
+	if len(domains) < 2 {
+		t.Skipf("Spreading needs at least 2 schedulable %s domains, found %d", topologyKey, len(domains))
+	}
+	replicas := len(domains)
+
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas":      replicas,
+		"node_selector": nodeSelector,
+		"topology_spread_constraints": []map[string]interface{}{
+			{"topology_key": topologyKey},
+		},
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Getting pod list
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	require.Equal(t, replicas, len(pods), "expected number of pods")
+
+	ValidateScheduling(t, PodSpecsFromPods(pods), SchedulingExpectation{
+		NodeSelector: nodeSelector,
+		TopologyKeys: []string{topologyKey},
+	})
+	ValidatePodPlacement(t, kubectlOptions, pods)
+
+	distribution, err := TopologyDistribution(pods, k8s.GetNodes(t, kubectlOptions), pods[0].Spec.TopologySpreadConstraints[0])
+	require.NoError(t, err)
+	// Tainted-only domains count for the spread too, with no pods, as taints are ignored by default
+	for domain := range domains {
+		assert.Equal(t, 1, distribution[domain], "Domain %s should run exactly one delegate pod", domain)
+	}
+}
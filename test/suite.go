@@ -0,0 +1,145 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SuiteRun is a `go test -json` run of the suite by one of the matrix runners in cmd
+type SuiteRun struct {
+	// Name identifies the run in results, e.g. a binary or a provider version
+	Name    string
+	Package string
+	// Run, if set, selects the tests to run
+	Run     string
+	Timeout string
+	// ReportDir receives the raw event stream and is the TEST_REPORT_DIR of the run
+	ReportDir string
+	// Env is added to the runner's environment
+	Env []string
+}
+
+// SuiteResult is the outcome of a SuiteRun
+type SuiteResult struct {
+	Name     string            `json:"name"`
+	Version  string            `json:"version,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Passed   int               `json:"passed"`
+	Failed   int               `json:"failed"`
+	Skipped  int               `json:"skipped"`
+	Outcomes map[string]string `json:"outcomes"`
+}
+
+// OK reports whether the run completed with no failed test
+func (r SuiteResult) OK() bool {
+	return r.Error == "" && r.Failed == 0
+}
+
+// RunSuite runs the suite and counts the outcomes of its tests. Failing tests are reported in the
+// result rather than as an error.
+func RunSuite(run SuiteRun) SuiteResult {
+	result := SuiteResult{Name: run.Name, Outcomes: map[string]string{}}
+
+	if err := os.MkdirAll(run.ReportDir, 0755); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	events, err := os.Create(filepath.Join(run.ReportDir, "go-test.json"))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer events.Close()
+
+	args := []string{"test", "-json", "-count=1", "-timeout", run.Timeout}
+	if run.Run != "" {
+		args = append(args, "-run", run.Run)
+	}
+	args = append(args, run.Package)
+	fmt.Printf("== %s: go %s\n", run.Name, strings.Join(args, " "))
+
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(append(os.Environ(), run.Env...), "TEST_REPORT_DIR="+run.ReportDir)
+	cmd.Stdout = events
+	cmd.Stderr = os.Stderr
+	_ = cmd.Run()
+
+	if _, err := events.Seek(0, io.SeekStart); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Outcomes, err = TestOutcomes(events)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if len(result.Outcomes) == 0 && result.Error == "" {
+		result.Error = "no test results, see go-test.json"
+	}
+
+	tests := make([]string, 0, len(result.Outcomes))
+	for name := range result.Outcomes {
+		tests = append(tests, name)
+	}
+	sort.Strings(tests)
+	for _, name := range tests {
+		switch result.Outcomes[name] {
+		case "pass":
+			result.Passed++
+		case "fail":
+			result.Failed++
+			fmt.Printf("   FAIL %s\n", name)
+		case "skip":
+			result.Skipped++
+		}
+	}
+	return result
+}
+
+// CompareSuiteResults returns the tests whose outcome differs between the results of the runs
+// that could start
+func CompareSuiteResults(results []SuiteResult) []string {
+	var names []string
+	outcomes := make(map[string]map[string]string, len(results))
+	for _, result := range results {
+		if len(result.Outcomes) == 0 {
+			continue
+		}
+		names = append(names, result.Name)
+		outcomes[result.Name] = result.Outcomes
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	return CompareTestOutcomes(names, outcomes)
+}
+
+// PrintSuiteResults prints a table of the results and the tests whose outcome differs
+func PrintSuiteResults(w io.Writer, header string, results []SuiteResult, differences []string) {
+	fmt.Fprintf(w, "\n%-12s %-10s %7s %7s %7s\n", header, "VERSION", "PASSED", "FAILED", "SKIPPED")
+	for _, result := range results {
+		fmt.Fprintf(w, "%-12s %-10s %7d %7d %7d %s\n", result.Name, result.Version, result.Passed, result.Failed, result.Skipped, result.Error)
+	}
+	for _, diff := range differences {
+		fmt.Fprintf(w, "differs: %s\n", diff)
+	}
+}
+
+// WriteSuiteReport writes the report of a matrix runner as <dir>/<name>.json
+func WriteSuiteReport(dir, name string, report interface{}) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name+".json")
+	fmt.Printf("wrote %s\n", path)
+	return os.WriteFile(path, content, 0644)
+}
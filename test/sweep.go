@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of LeakedResource
+const (
+	LeakedNamespace   = "Namespace"
+	LeakedHelmRelease = "HelmRelease"
+)
+
+// releaseLabel names the Helm release on the chart's workloads
+const releaseLabel = "app.kubernetes.io/instance"
+
+// LeakedResource is a namespace or Helm release a test run left behind
+type LeakedResource struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Age       time.Duration
+}
+
+// String returns the resource as Kind namespace/name
+func (r LeakedResource) String() string {
+	if r.Kind == LeakedNamespace {
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// testResourceAge returns the age of a test resource from its TestCreatedAtLabel, falling back
+// to its creation timestamp
+func testResourceAge(meta metav1.ObjectMeta, now time.Time) time.Duration {
+	if seconds, err := strconv.ParseInt(meta.Labels[TestCreatedAtLabel], 10, 64); err == nil {
+		return now.Sub(time.Unix(seconds, 0))
+	}
+	return now.Sub(meta.CreationTimestamp.Time)
+}
+
+// FindLeakedResources lists the test namespaces, and the Helm releases outside of them, that are
+// older than ttl. Releases are found through the test labels the tests pass as common_labels, as
+// Helm does not label its release records.
+func FindLeakedResources(ctx context.Context, client kubernetes.Interface, ttl time.Duration, now time.Time) ([]LeakedResource, error) {
+	selector := fmt.Sprintf("%s=%s", TestManagedByLabel, TestManagedByValue)
+	var leaked []LeakedResource
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	testNamespaces := make(map[string]bool, len(namespaces.Items))
+	for _, namespace := range namespaces.Items {
+		testNamespaces[namespace.Name] = true
+		// Namespaces already terminating are on their way out
+		if namespace.DeletionTimestamp != nil {
+			continue
+		}
+		if age := testResourceAge(namespace.ObjectMeta, now); age > ttl {
+			leaked = append(leaked, LeakedResource{Kind: LeakedNamespace, Name: namespace.Name, Age: age})
+		}
+	}
+
+	// Releases in test namespaces go with the namespace
+	deployments, err := client.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, deployment := range deployments.Items {
+		release := deployment.Labels[releaseLabel]
+		key := fmt.Sprintf("%s/%s", deployment.Namespace, release)
+		if release == "" || testNamespaces[deployment.Namespace] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if age := testResourceAge(deployment.ObjectMeta, now); age > ttl {
+			leaked = append(leaked, LeakedResource{Kind: LeakedHelmRelease, Namespace: deployment.Namespace, Name: release, Age: age})
+		}
+	}
+
+	sort.Slice(leaked, func(i, j int) bool {
+		return leaked[i].String() < leaked[j].String()
+	})
+	return leaked, nil
+}
+
+// SweepLeakedResources deletes the leaked namespaces and uninstalls the leaked releases with
+// uninstall. It carries on past failures and returns the resources it could not remove.
+func SweepLeakedResources(ctx context.Context, client kubernetes.Interface, leaked []LeakedResource, uninstall func(namespace, release string) error) ([]LeakedResource, error) {
+	var failed []LeakedResource
+	var firstErr error
+	for _, resource := range leaked {
+		var err error
+		switch resource.Kind {
+		case LeakedNamespace:
+			err = client.CoreV1().Namespaces().Delete(ctx, resource.Name, metav1.DeleteOptions{})
+		case LeakedHelmRelease:
+			err = uninstall(resource.Namespace, resource.Name)
+		default:
+			err = fmt.Errorf("unknown kind %s", resource.Kind)
+		}
+		if err != nil {
+			failed = append(failed, resource)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("sweeping %s: %w", resource, err)
+			}
+		}
+	}
+	return failed, firstErr
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTestResourceLabels(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	labels := TestResourceLabels(t, now)
+	assert.Equal(t, TestManagedByValue, labels[TestManagedByLabel])
+	assert.Equal(t, "1700000000", labels[TestCreatedAtLabel])
+	assert.Equal(t, "TestTestResourceLabels", labels[TestNameLabel])
+
+	// Subtest names hold a slash and can exceed the label value limit
+	assert.Equal(t, "TestX-case_1", labelValue("TestX/case_1"))
+	long := labelValue("TestX/" + strings.Repeat("a", 80))
+	assert.Len(t, long, 63)
+	assert.Equal(t, "a", labelValue("/a-"))
+}
+
+func TestFindLeakedResources(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	testLabels := func(age time.Duration) map[string]string {
+		return map[string]string{
+			TestManagedByLabel: TestManagedByValue,
+			TestCreatedAtLabel: strconv.FormatInt(now.Add(-age).Unix(), 10),
+		}
+	}
+	terminating := metav1.NewTime(now)
+	withRelease := func(labels map[string]string, release string) map[string]string {
+		labels[releaseLabel] = release
+		return labels
+	}
+
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "stale", Labels: testLabels(3 * time.Hour)}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "fresh", Labels: testLabels(10 * time.Minute)}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "terminating", Labels: testLabels(3 * time.Hour), DeletionTimestamp: &terminating}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shared"}},
+		// Only the release outside the test namespaces is reported
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "in-stale", Namespace: "stale", Labels: withRelease(testLabels(3*time.Hour), "in-stale")}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "leaked", Namespace: "shared", Labels: withRelease(testLabels(3*time.Hour), "leaked")}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "shared", Labels: withRelease(testLabels(10*time.Minute), "running")}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "not-a-test", Namespace: "shared", Labels: map[string]string{releaseLabel: "not-a-test"}}},
+	)
+
+	leaked, err := FindLeakedResources(context.Background(), client, time.Hour, now)
+	require.NoError(t, err)
+	assert.Equal(t, []LeakedResource{
+		{Kind: LeakedHelmRelease, Namespace: "shared", Name: "leaked", Age: 3 * time.Hour},
+		{Kind: LeakedNamespace, Name: "stale", Age: 3 * time.Hour},
+	}, leaked)
+}
+
+func TestSweepLeakedResources(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "stale"}},
+	)
+	leaked := []LeakedResource{
+		{Kind: LeakedNamespace, Name: "stale"},
+		{Kind: LeakedHelmRelease, Namespace: "shared", Name: "broken"},
+		{Kind: LeakedHelmRelease, Namespace: "shared", Name: "leaked"},
+	}
+
+	var uninstalled []string
+	uninstall := func(namespace, release string) error {
+		if release == "broken" {
+			return errors.New("uninstall failed")
+		}
+		uninstalled = append(uninstalled, namespace+"/"+release)
+		return nil
+	}
+
+	failed, err := SweepLeakedResources(context.Background(), client, leaked, uninstall)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HelmRelease shared/broken")
+	assert.Equal(t, []LeakedResource{leaked[1]}, failed)
+	assert.Equal(t, []string{"shared/leaked"}, uninstalled)
+
+	namespaces, err := client.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, namespaces.Items)
+}
@@ -0,0 +1,30 @@
+resource "helm_release" "delegate" {
+  name  = var.delegate_name
+  chart = "harness-delegate-ng"
+
+  values = [data.utils_deep_merge_yaml.values.output]
+
+  set_sensitive {
+    name  = "delegateToken"
+    value = var.delegate_token
+  }
+
+  set_sensitive {
+    name  = "delegateToken"
+    value = var.delegate_token
+  }
+}
+
+locals {
+  values = yamlencode({
+    accountId    = var.account_id,
+    delegateName = var.delegate_name,
+    accountId    = var.account_id,
+    upgrader     = { enabled = var.upgrader_enabled, enabled = true }
+    proxyHost    = var.proxy_host
+  })
+}
+
+data "utils_deep_merge_yaml" "values" {
+  input = [local.values]
+}
@@ -0,0 +1,19 @@
+variable "delegate_name" {
+  type = string
+}
+
+variable "account_id" {
+  type = string
+}
+
+variable "delegate_token" {
+  type = string
+}
+
+variable "upgrader_enabled" {
+  type = bool
+}
+
+variable "forgotten" {
+  type = string
+}
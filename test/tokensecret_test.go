@@ -0,0 +1,98 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// tokenSecretRef returns the secretKeyRef of the DELEGATE_TOKEN env of the container, if any
+func tokenSecretRef(container corev1.Container) *corev1.SecretKeySelector {
+	for _, env := range container.Env {
+		if env.Name == "DELEGATE_TOKEN" && env.ValueFrom != nil {
+			return env.ValueFrom.SecretKeyRef
+		}
+	}
+	return nil
+}
+
+func TestRenderedDelegateExistingTokenSecret(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+	delete(vars, "delegate_token")
+	vars["existing_delegate_token_secret_name"] = "delegate-token"
+	vars["existing_delegate_token_secret_key"] = "token"
+
+	options := &terraform.Options{
+		TerraformDir: CopyModuleDir(t),
+		Vars:         vars,
+	}
+	values := RenderDelegateValues(t, options)
+	assert.NotContains(t, values, TokenChecksumAnnotation, "No checksum should be derived without a token variable")
+
+	workloads := RenderedWorkloads(t, options)
+	delegate := FindWorkload(t, workloads, "Deployment", delegateName)
+
+	ref := tokenSecretRef(delegate.Template.Spec.Containers[0])
+	require.NotNil(t, ref, "DELEGATE_TOKEN should come from the existing Secret")
+	assert.Equal(t, "delegate-token", ref.Name)
+	assert.Equal(t, "token", ref.Key)
+}
+
+func TestDelegateWithExistingTokenSecret(t *testing.T) {
+	t.Parallel()
+
+	// Get unique resource names for parallel testing
+	uniqueID := strings.ToLower(random.UniqueId())
+	delegateName := fmt.Sprintf("test-delegate-%s", uniqueID)
+	env := LoadLiveDelegateEnv()
+	replicas := 1
+	secretName := "delegate-token"
+	secretKey := "token"
+
+	// Create the namespace and the token Secret out-of-band
+	testNamespace := AllocateNamespace(t, "harness-delegate-token")
+	kubectlOptions := testNamespace.KubectlOptions
+	CreateDelegateTokenSecret(t, kubectlOptions, secretName, secretKey, env.DelegateToken)
+
+	// No delegate_token variable at all
+	terraformOptions := LiveTerraformOptions(t, testNamespace, delegateName, map[string]interface{}{
+		"replicas":                            replicas,
+		"delegate_token":                      nil,
+		"existing_delegate_token_secret_name": secretName,
+		"existing_delegate_token_secret_key":  secretKey,
+	})
+
+	// Run terraform init and apply
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Wait for the deployment to be ready
+	k8s.WaitUntilDeploymentAvailable(t, kubectlOptions, delegateName, 8, 30*time.Second)
+
+	// Getting pod list
+	deployment := k8s.GetDeployment(t, kubectlOptions, delegateName)
+	pods := k8s.ListPods(t, kubectlOptions, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	require.Equal(t, replicas, len(pods), "expected number of pods")
+
+	// The delegate consumes the token from the existing Secret
+	container := pods[0].Spec.Containers[0]
+	ref := tokenSecretRef(container)
+	require.NotNil(t, ref, "DELEGATE_TOKEN should come from the existing Secret")
+	assert.Equal(t, secretName, ref.Name)
+	envMap := ResolveContainerEnvMap(t, kubectlOptions, container)
+	require.Equal(t, TokenChecksum(env.DelegateToken), TokenChecksum(envMap["DELEGATE_TOKEN"]), "Delegate should consume the token from Secret %s", secretName)
+
+	// No token material may reach the state
+	ValidateStateHasNoSecrets(t, terraformOptions, env.DelegateToken)
+}
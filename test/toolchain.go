@@ -0,0 +1,284 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+)
+
+// IaCBinaryEnv selects the Terraform-compatible binary, e.g. terraform or tofu, used by every test
+// of the run. It is set per binary by the toolchain runner in cmd/toolchains.
+const IaCBinaryEnv = "IAC_BINARY"
+
+// IaCBinariesEnv lists the binaries to compare, comma-separated
+const IaCBinariesEnv = "IAC_BINARIES"
+
+// InstallIaCBinary makes the IAC_BINARY binary the default of every terraform.Options without an
+// explicit TerraformBinary. terratest otherwise picks terraform, or tofu if terraform is missing.
+func InstallIaCBinary() {
+	if binary := os.Getenv(IaCBinaryEnv); binary != "" {
+		terraform.DefaultExecutable = binary
+	}
+}
+
+// IaCBinaries returns the binaries listed in IAC_BINARIES, or the default binary
+func IaCBinaries() []string {
+	var binaries []string
+	for _, binary := range strings.Split(os.Getenv(IaCBinariesEnv), ",") {
+		if binary = strings.TrimSpace(binary); binary != "" {
+			binaries = append(binaries, binary)
+		}
+	}
+	if len(binaries) == 0 {
+		binaries = append(binaries, terraform.DefaultExecutable)
+	}
+	return binaries
+}
+
+// IaCVersionE returns the version reported by `<binary> version -json`. OpenTofu reports it under
+// the same terraform_version key as Terraform.
+func IaCVersionE(binary string) (string, error) {
+	if _, err := exec.LookPath(binary); err != nil {
+		return "", err
+	}
+	output, err := exec.Command(binary, "version", "-json").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s version -json: %w", binary, err)
+	}
+	var version struct {
+		Version string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal(output, &version); err != nil {
+		return "", fmt.Errorf("parsing %s version: %w", binary, err)
+	}
+	return version.Version, nil
+}
+
+// PlanSummary is the part of a plan JSON document that should not depend on the binary, together
+// with what the binary-specific parsing found
+type PlanSummary struct {
+	FormatVersion string `json:"format_version"`
+	ToolVersion   string `json:"tool_version"`
+	// ParseError is set when terratest could not parse the plan, e.g. for an unsupported format version
+	ParseError string `json:"parse_error,omitempty"`
+	// UnparsedKeys are top-level plan keys not modelled by the terraform-json version in go.mod, and
+	// therefore invisible to plan assertions
+	UnparsedKeys []string `json:"unparsed_keys,omitempty"`
+	// ResourceActions maps resource addresses to their planned actions, e.g. "create" or "delete-create"
+	ResourceActions map[string]string `json:"resource_actions"`
+	// Outputs maps output names to their planned values as JSON
+	Outputs map[string]string `json:"outputs"`
+}
+
+// planKeys are the top-level plan keys terraform-json models
+var planKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	planType := reflect.TypeOf(tfjson.Plan{})
+	for i := 0; i < planType.NumField(); i++ {
+		if name := strings.Split(planType.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}()
+
+// plannedOutput returns the planned value of an output as JSON, or a marker for unknown and
+// sensitive values
+func plannedOutput(change *tfjson.Change) string {
+	if sensitive, ok := change.AfterSensitive.(bool); ok && sensitive {
+		return "(sensitive)"
+	}
+	if unknown, ok := change.AfterUnknown.(bool); ok && unknown {
+		return "(known after apply)"
+	}
+	value, err := json.Marshal(change.After)
+	if err != nil {
+		return fmt.Sprintf("(unencodable: %v)", err)
+	}
+	return string(value)
+}
+
+// SummarizePlanJSON summarizes the output of `show -json` for a plan file. Parsing failures are
+// recorded in the summary rather than returned, as they are results in their own right.
+func SummarizePlanJSON(planJSON string) PlanSummary {
+	summary := PlanSummary{ResourceActions: make(map[string]string), Outputs: make(map[string]string)}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(planJSON), &raw); err != nil {
+		summary.ParseError = err.Error()
+		return summary
+	}
+	for key := range raw {
+		if !planKeys[key] {
+			summary.UnparsedKeys = append(summary.UnparsedKeys, key)
+		}
+	}
+	sort.Strings(summary.UnparsedKeys)
+	_ = json.Unmarshal(raw["format_version"], &summary.FormatVersion)
+	_ = json.Unmarshal(raw["terraform_version"], &summary.ToolVersion)
+
+	plan, err := terraform.ParsePlanJSON(planJSON)
+	if err != nil {
+		summary.ParseError = err.Error()
+		return summary
+	}
+	for address, change := range plan.ResourceChangesMap {
+		actions := make([]string, 0, len(change.Change.Actions))
+		for _, action := range change.Change.Actions {
+			actions = append(actions, string(action))
+		}
+		summary.ResourceActions[address] = strings.Join(actions, "-")
+	}
+	for name, change := range plan.RawPlan.OutputChanges {
+		summary.Outputs[name] = plannedOutput(change)
+	}
+	return summary
+}
+
+// DiffPlanSummaries returns the differences in parsing, resource actions and outputs between two
+// plan summaries. Format and tool versions are expected to differ and are not compared.
+func DiffPlanSummaries(base, other PlanSummary) []string {
+	var diffs []string
+	if base.ParseError != other.ParseError {
+		diffs = append(diffs, fmt.Sprintf("parse error: %q != %q", base.ParseError, other.ParseError))
+	}
+	diffMaps := func(kind string, a, b map[string]string) {
+		keys := make(map[string]bool)
+		for key := range a {
+			keys[key] = true
+		}
+		for key := range b {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			valueA, inA := a[key]
+			valueB, inB := b[key]
+			switch {
+			case !inA:
+				diffs = append(diffs, fmt.Sprintf("%s %s: only in the second plan", kind, key))
+			case !inB:
+				diffs = append(diffs, fmt.Sprintf("%s %s: only in the first plan", kind, key))
+			case valueA != valueB:
+				diffs = append(diffs, fmt.Sprintf("%s %s: %s != %s", kind, key, valueA, valueB))
+			}
+		}
+	}
+	diffMaps("resource", base.ResourceActions, other.ResourceActions)
+	diffMaps("output", base.Outputs, other.Outputs)
+	return diffs
+}
+
+// ToolchainResult is the outcome of one binary in a toolchain comparison
+type ToolchainResult struct {
+	Binary  string      `json:"binary"`
+	Version string      `json:"version"`
+	Plan    PlanSummary `json:"plan"`
+	// Differences are the plan differences with the first binary
+	Differences []string `json:"differences,omitempty"`
+}
+
+// PlanWithIaCBinary plans the module with the given binary, in its own copy of the module so that
+// lock files and provider caches of different binaries don't mix, and summarizes the plan
+func PlanWithIaCBinary(t *testing.T, terraformOptions *terraform.Options, binary string) ToolchainResult {
+	version, err := IaCVersionE(binary)
+	require.NoError(t, err, "Binary %s should be installed", binary)
+
+	options, err := terraformOptions.Clone()
+	require.NoError(t, err)
+	// The clone does not keep the logger
+	options.Logger = terraformOptions.Logger
+	options.TerraformBinary = binary
+	options.TerraformDir = CopyModuleDir(t)
+	options.PlanFilePath = fmt.Sprintf("%s/%s.tfplan", t.TempDir(), binary)
+
+	planJSON := terraform.InitAndPlanAndShow(t, options)
+	return ToolchainResult{Binary: binary, Version: version, Plan: SummarizePlanJSON(planJSON)}
+}
+
+// CompareToolchains fills in the differences of every result with the first one
+func CompareToolchains(results []ToolchainResult) {
+	for i := 1; i < len(results); i++ {
+		results[i].Differences = DiffPlanSummaries(results[0].Plan, results[i].Plan)
+	}
+}
+
+// TestOutcomes reads a `go test -json` stream and returns the final action, pass, fail or skip, of
+// every test and subtest
+func TestOutcomes(r io.Reader) (map[string]string, error) {
+	outcomes := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Action string
+			Test   string
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// Build failures and the like are printed as plain text
+			continue
+		}
+		if event.Test == "" {
+			continue
+		}
+		switch event.Action {
+		case "pass", "fail", "skip":
+			outcomes[event.Test] = event.Action
+		}
+	}
+	return outcomes, scanner.Err()
+}
+
+// CompareTestOutcomes returns the tests whose outcome differs between binaries, as
+// "<test>: <binary>=<outcome> ..." with binaries in the given order
+func CompareTestOutcomes(binaries []string, outcomes map[string]map[string]string) []string {
+	tests := make(map[string]bool)
+	for _, byTest := range outcomes {
+		for test := range byTest {
+			tests[test] = true
+		}
+	}
+	sorted := make([]string, 0, len(tests))
+	for test := range tests {
+		sorted = append(sorted, test)
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, test := range sorted {
+		var parts []string
+		var first string
+		same := true
+		for i, binary := range binaries {
+			outcome, ok := outcomes[binary][test]
+			if !ok {
+				outcome = "missing"
+			}
+			if i == 0 {
+				first = outcome
+			} else if outcome != first {
+				same = false
+			}
+			parts = append(parts, fmt.Sprintf("%s=%s", binary, outcome))
+		}
+		if !same {
+			diffs = append(diffs, fmt.Sprintf("%s: %s", test, strings.Join(parts, " ")))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPlanFixture(t *testing.T, name string) string {
+	content, err := os.ReadFile(fmt.Sprintf("testdata/toolchain/%s.plan.json", name))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestSummarizePlanJSON(t *testing.T) {
+	terraformPlan := SummarizePlanJSON(loadPlanFixture(t, "terraform"))
+	tofuPlan := SummarizePlanJSON(loadPlanFixture(t, "tofu"))
+
+	assert.Empty(t, terraformPlan.ParseError)
+	assert.Equal(t, "1.2", terraformPlan.FormatVersion)
+	assert.Equal(t, "1.9.8", terraformPlan.ToolVersion)
+	assert.Equal(t, map[string]string{"helm_release.delegate": "create"}, terraformPlan.ResourceActions)
+	assert.Equal(t, `"accountId: test_account_id\ndelegateName: test-delegate\n"`, terraformPlan.Outputs["values"])
+	assert.Equal(t, []string{"applyable", "complete", "errored", "relevant_attributes", "timestamp"}, terraformPlan.UnparsedKeys)
+
+	// The registry host in provider addresses differs, the plan itself does not
+	assert.Equal(t, "1.8.5", tofuPlan.ToolVersion)
+	assert.Equal(t, []string{"errored", "relevant_attributes", "timestamp"}, tofuPlan.UnparsedKeys)
+	assert.Empty(t, DiffPlanSummaries(terraformPlan, tofuPlan))
+
+	// A format version outside what terraform-json supports is a parse failure, not a panic
+	unsupported := SummarizePlanJSON(strings.Replace(loadPlanFixture(t, "tofu"), `"format_version": "1.2"`, `"format_version": "2.0"`, 1))
+	assert.Equal(t, "2.0", unsupported.FormatVersion)
+	assert.Contains(t, unsupported.ParseError, "unsupported plan format version")
+	assert.NotEmpty(t, SummarizePlanJSON("not json").ParseError)
+}
+
+func TestDiffPlanSummaries(t *testing.T) {
+	base := PlanSummary{
+		ResourceActions: map[string]string{"helm_release.delegate": "create"},
+		Outputs:         map[string]string{"values": `"a"`, "token": "(sensitive)"},
+	}
+	other := PlanSummary{
+		ParseError:      "unsupported plan format version",
+		ResourceActions: map[string]string{"helm_release.delegate": "delete-create", "kubernetes_namespace.this": "create"},
+		Outputs:         map[string]string{"values": "(known after apply)"},
+	}
+
+	assert.Equal(t, []string{
+		`parse error: "" != "unsupported plan format version"`,
+		"resource helm_release.delegate: create != delete-create",
+		"resource kubernetes_namespace.this: only in the second plan",
+		"output token: only in the first plan",
+		`output values: "a" != (known after apply)`,
+	}, DiffPlanSummaries(base, other))
+	assert.Empty(t, DiffPlanSummaries(base, base))
+}
+
+func TestTestOutcomes(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"Action":"run","Test":"TestA"}`,
+		`{"Action":"pass","Test":"TestA"}`,
+		`{"Action":"run","Test":"TestB"}`,
+		`{"Action":"output","Test":"TestB","Output":"--- FAIL: TestB\n"}`,
+		`{"Action":"fail","Test":"TestB"}`,
+		`{"Action":"skip","Test":"TestC/case"}`,
+		`# github.com/example/broken [build failed]`,
+		`{"Action":"fail"}`,
+	}, "\n")
+
+	outcomes, err := TestOutcomes(strings.NewReader(stream))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TestA": "pass", "TestB": "fail", "TestC/case": "skip"}, outcomes)
+
+	assert.Equal(t, []string{
+		"TestB: terraform=fail tofu=pass",
+		"TestC/case: terraform=skip tofu=missing",
+	}, CompareTestOutcomes([]string{"terraform", "tofu"}, map[string]map[string]string{
+		"terraform": outcomes,
+		"tofu":      {"TestA": "pass", "TestB": "pass"},
+	}))
+}
+
+func TestRenderedToolchainPlanParity(t *testing.T) {
+	delegateName := fmt.Sprintf("test-delegate-%s", strings.ToLower(random.UniqueId()))
+	vars := DefaultTerraformVars("harness-delegate-ng", delegateName)
+	vars["values"] = LoadValuesOverlay(t, "resources-consistent.yaml")
+	terraformOptions := &terraform.Options{
+		Vars: vars,
+		// Only the values are planned, so no cluster is needed
+		Targets: []string{"data.utils_deep_merge_yaml.values"},
+	}
+
+	var results []ToolchainResult
+	for _, binary := range IaCBinaries() {
+		result := PlanWithIaCBinary(t, terraformOptions, binary)
+		require.Empty(t, result.Plan.ParseError, "The %s plan should parse", binary)
+		results = append(results, result)
+	}
+	CompareToolchains(results)
+	WriteJSONReport(t, "toolchain", results)
+
+	for _, result := range results[1:] {
+		assert.Empty(t, result.Differences, "The %s %s plan should match the %s %s plan", result.Binary, result.Version, results[0].Binary, results[0].Version)
+	}
+}
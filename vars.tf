@@ -5,11 +5,23 @@ variable "create_namespace" {
 }
 
 variable "helm_repository" {
-  description = "The Helm repository to use."
+  description = "The Helm repository to use. Use an oci:// URL for an OCI registry, or an empty string to install var.chart from a local path."
   type        = string
   default     = "https://app.harness.io/storage/harness-download/delegate-helm-chart/"
 }
 
+variable "chart" {
+  description = "The chart to install: a chart name in var.helm_repository, or a local chart path when var.helm_repository is empty."
+  type        = string
+  default     = "harness-delegate-ng"
+}
+
+variable "chart_version" {
+  description = "The chart version to install. Defaults to the latest version."
+  type        = string
+  default     = ""
+}
+
 variable "namespace" {
   description = "The namespace to deploy the Harness delegate to."
   type        = string
@@ -34,9 +46,22 @@ variable "account_id" {
 }
 
 variable "delegate_token" {
-  description = "The account secret to use for the Harness delegate."
+  description = "The account secret to use for the Harness delegate. Changing it restarts the delegate pods. Leave empty when using existing_delegate_token_secret_name."
   type        = string
-  // sensitive = true
+  sensitive   = true
+  default     = ""
+}
+
+variable "existing_delegate_token_secret_name" {
+  description = "The name of an existing Secret in var.namespace holding the delegate token. Keeps the token out of the Terraform state. Adds a DELEGATE_TOKEN entry to custom_envs, kept when var.values sets custom_envs."
+  type        = string
+  default     = ""
+}
+
+variable "existing_delegate_token_secret_key" {
+  description = "The key of the delegate token in the existing Secret."
+  type        = string
+  default     = "DELEGATE_TOKEN"
 }
 
 variable "manager_endpoint" {
@@ -62,18 +87,130 @@ variable "replicas" {
   default     = 1
 }
 
+variable "autoscaling" {
+  description = "Enable a HorizontalPodAutoscaler for the delegate. The chart then leaves the Deployment's replicas unset, so the HPA owns the replica count and var.replicas is ignored."
+  type = object({
+    min_replicas              = optional(number, 1)
+    max_replicas              = number
+    target_cpu_utilization    = optional(number, 80)
+    target_memory_utilization = optional(number)
+  })
+  default = null
+
+  validation {
+    condition     = var.autoscaling == null || try(var.autoscaling.min_replicas <= var.autoscaling.max_replicas, false)
+    error_message = "autoscaling.min_replicas must not exceed autoscaling.max_replicas."
+  }
+}
+
+variable "pod_disruption_budget" {
+  description = "Create a PodDisruptionBudget for the delegate pods with one of min_available or max_unavailable."
+  type = object({
+    min_available   = optional(number)
+    max_unavailable = optional(number)
+  })
+  default = null
+
+  validation {
+    condition     = var.pod_disruption_budget == null || (try(var.pod_disruption_budget.min_available, null) == null) != (try(var.pod_disruption_budget.max_unavailable, null) == null)
+    error_message = "Set exactly one of min_available and max_unavailable."
+  }
+}
+
 variable "upgrader_enabled" {
   description = "Is upgrader enabled"
   type        = bool
   default     = true
 }
 
+variable "upgrader_image" {
+  description = "The image of upgrader. Defaults to the chart image."
+  type        = string
+  default     = ""
+}
+
+variable "image_pull_secrets" {
+  description = "Names of existing image pull secrets for the delegate and upgrader pods."
+  type        = list(string)
+  default     = []
+}
+
 variable "mtls_secret_name" {
   description = "The name of the mTLS secret."
   type        = string
   default     = ""
 }
 
+variable "ca_bundle_secret_name" {
+  description = "The name of an existing Secret holding a PEM CA bundle to trust, e.g. for TLS-intercepting proxies. Adds entries to custom_volumes, custom_mounts and custom_envs, kept when var.values sets those lists."
+  type        = string
+  default     = ""
+}
+
+variable "ca_bundle_configmap_name" {
+  description = "The name of an existing ConfigMap holding a PEM CA bundle to trust. Mutually exclusive with ca_bundle_secret_name. Adds entries to custom_volumes, custom_mounts and custom_envs, kept when var.values sets those lists."
+  type        = string
+  default     = ""
+}
+
+variable "ca_bundle_key" {
+  description = "The key of the CA bundle in the Secret or ConfigMap."
+  type        = string
+  default     = "ca.bundle"
+}
+
+variable "common_labels" {
+  description = "Labels added to every object the chart creates, e.g. for cost allocation."
+  type        = map(string)
+  default     = {}
+
+  validation {
+    condition     = alltrue([for value in values(var.common_labels) : can(regex("^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$", value)) && length(value) <= 63])
+    error_message = "Label values must be 63 characters or less and consist of alphanumerics, '-', '_' or '.'."
+  }
+}
+
+variable "common_annotations" {
+  description = "Annotations added to every object the chart creates."
+  type        = map(string)
+  default     = {}
+}
+
+variable "node_selector" {
+  description = "Node labels the delegate pods must be scheduled on, e.g. a tooling node pool."
+  type        = map(string)
+  default     = {}
+}
+
+variable "tolerations" {
+  description = "Tolerations for the delegate pods, e.g. for tainted tooling node pools."
+  type = list(object({
+    key                = optional(string)
+    operator           = optional(string, "Equal")
+    value              = optional(string)
+    effect             = optional(string)
+    toleration_seconds = optional(number)
+  }))
+  default = []
+}
+
+variable "affinity" {
+  description = "Affinity for the delegate pods, in the Kubernetes `affinity` format."
+  type        = any
+  default     = {}
+}
+
+variable "topology_spread_constraints" {
+  description = "Spread the delegate pods across topology domains such as zones. match_labels defaults to the release's pods."
+  type = list(object({
+    topology_key       = string
+    max_skew           = optional(number, 1)
+    when_unsatisfiable = optional(string, "DoNotSchedule")
+    match_labels       = optional(map(string))
+  }))
+  default = []
+}
+
 variable "proxy_user" {
   description = "The proxy user to use for the Harness delegate."
   type        = string
@@ -119,7 +256,7 @@ variable "init_script" {
 }
 
 variable "values" {
-  description = "Additional values to pass to the helm chart. Values will be merged, in order, as Helm does with multiple -f options"
+  description = "Additional values to pass to the helm chart. Values will be merged, in order, as Helm does with multiple -f options. Entries of custom_envs, custom_volumes and custom_mounts are appended to the ones the module adds for the CA bundle and the existing token Secret instead of replacing them"
   type        = string
   default     = ""
 }
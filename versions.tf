@@ -1,8 +1,11 @@
 terraform {
+  # optional() object attributes with defaults
+  required_version = ">= 1.3.0"
+
   required_providers {
     helm = {
       source  = "hashicorp/helm"
-      version = ">= 2.9.0, < 3.0.0-0"
+      version = ">= 3.0.0, < 4.0.0"
     }
     utils = {
       source  = "cloudposse/utils"